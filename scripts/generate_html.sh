@@ -1,4 +1,4 @@
 #!/bin/bash
 
 cd "$(dirname "$0")" || exit "$?"
-go run ./main.go generate-html ./config.json ../slacklog_template/ ../slacklog_data/ ../slacklog_pages/
+go run ./main.go generate-html -config ./config.json
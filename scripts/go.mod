@@ -1,11 +1,32 @@
 module github.com/vim-jp/slacklog
 
-go 1.14
+go 1.21
 
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/alecthomas/chroma/v2 v2.14.0
 	github.com/joho/godotenv v1.3.0
 	github.com/kyokomi/emoji v2.2.2+incompatible
-	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/slack-go/slack v0.6.4
+	golang.org/x/net v0.24.0
+	modernc.org/sqlite v1.29.10
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dlclark/regexp2 v1.11.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/websocket v1.2.0 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/sys v0.19.0 // indirect
+	modernc.org/gc/v3 v3.0.0-20240107210532-573471604cb6 // indirect
+	modernc.org/libc v1.49.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+	modernc.org/strutil v1.2.0 // indirect
+	modernc.org/token v1.1.0 // indirect
 )
@@ -0,0 +1,225 @@
+package slacklog
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dateLayout : dateIndexで日付を表わす文字列の形式
+const dateLayout = "2006-01-02"
+
+// dateIndex : 月毎のページを生成しながら、日毎の投稿数を集計する。
+// チャンネルのカレンダーや、チャンネル横断のタイムラインの生成に用いる。
+// 複数のワーカーから同時に呼ばれるため排他制御している。
+type dateIndex struct {
+	mu sync.Mutex
+	// スレッドへの返信を含む投稿数
+	// key: channel ID, date
+	counts map[string]map[string]int
+	// 全チャンネルのチャンネルに表示するメッセージの数
+	// key: date
+	days map[string]int
+	// 月毎のページや日毎のページにメッセージが並ぶ日
+	// key: channel ID, date
+	paged map[string]map[string]struct{}
+	// 返信のみの日のリンク先とする、その日の最初の返信
+	// key: channel ID, date
+	replies map[string]map[string]replyLink
+}
+
+// replyLink : スレッドへの返信と、それを表示するページへのリンク
+type replyLink struct {
+	ts  string
+	url string
+}
+
+func newDateIndex() *dateIndex {
+	return &dateIndex{
+		counts:  map[string]map[string]int{},
+		days:    map[string]int{},
+		paged:   map[string]map[string]struct{}{},
+		replies: map[string]map[string]replyLink{},
+	}
+}
+
+// add : チャンネルのページに並ぶメッセージmsgを数える。shownがtrueならタイムラ
+// インにも数える。
+func (d *dateIndex) add(channelID string, msg Message, shown bool) {
+	date := TsToDateTime(msg.Ts).Format(dateLayout)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.count(channelID, date)
+	if d.paged[channelID] == nil {
+		d.paged[channelID] = map[string]struct{}{}
+	}
+	d.paged[channelID][date] = struct{}{}
+	if shown {
+		d.days[date]++
+	}
+}
+
+// addReply : スレッド内にのみ表示する返信msgを数える。
+// 返信の日のページがあるとは限らないため、urlには返信を表示するページ(先頭のメッ
+// セージのページ)へのリンクを渡す。
+func (d *dateIndex) addReply(channelID string, msg Message, url string) {
+	date := TsToDateTime(msg.Ts).Format(dateLayout)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.count(channelID, date)
+	if d.replies[channelID] == nil {
+		d.replies[channelID] = map[string]replyLink{}
+	}
+	// months are collected in parallel, so keep the earliest reply.
+	if r, ok := d.replies[channelID][date]; !ok || msg.Ts < r.ts {
+		d.replies[channelID][date] = replyLink{ts: msg.Ts, url: url}
+	}
+}
+
+func (d *dateIndex) count(channelID, date string) {
+	counts, ok := d.counts[channelID]
+	if !ok {
+		counts = map[string]int{}
+		d.counts[channelID] = counts
+	}
+	counts[date]++
+}
+
+// dayLink : チャンネルのdateの日のリンク先を返す。
+// その日のメッセージが並ぶページがあればdayURLを、返信のみの日であれば最初の返
+// 信へのリンクを返す。
+func (d *dateIndex) dayLink(channelID string, date time.Time, dayURL func(t time.Time) string) string {
+	key := date.Format(dateLayout)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.paged[channelID][key]; ok {
+		return dayURL(date)
+	}
+	return d.replies[channelID][key].url
+}
+
+// channelCounts : チャンネルの日毎の投稿数を返す。
+func (d *dateIndex) channelCounts(channelID string) map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.counts[channelID]
+}
+
+// dayCounts : 全チャンネルの日毎のチャンネルに表示するメッセージの数を返す。
+func (d *dateIndex) dayCounts() map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.days
+}
+
+// CalendarYear : カレンダーの一年分。
+// Rowsは曜日(日曜始まり)毎の行で、各行は週毎の列からなる。
+type CalendarYear struct {
+	Year int
+	Rows [7][]CalendarDay
+}
+
+// CalendarDay : カレンダーの一日分のセル。
+type CalendarDay struct {
+	Date time.Time
+	// その年の日でない場合はfalse。週の端を埋めるための空のセルとなる。
+	Valid bool
+	Count int
+	// 0から4までの投稿数の多さの段階
+	Level int
+	// 投稿がある日のみ設定される
+	URL string
+}
+
+// buildCalendar : 日毎の投稿数からカレンダーを作る。投稿がある最初の年から最後
+// の年までを新しい順に返す。
+// urlOfは投稿がある日のリンク先を返す。
+func buildCalendar(counts map[string]int, urlOf func(t time.Time) string) []CalendarYear {
+	if len(counts) == 0 {
+		return nil
+	}
+	minYear, maxYear, maxCount := 0, 0, 0
+	for date, n := range counts {
+		t, err := time.Parse(dateLayout, date)
+		if err != nil {
+			continue
+		}
+		if minYear == 0 || t.Year() < minYear {
+			minYear = t.Year()
+		}
+		if t.Year() > maxYear {
+			maxYear = t.Year()
+		}
+		if n > maxCount {
+			maxCount = n
+		}
+	}
+
+	var years []CalendarYear
+	for year := maxYear; year >= minYear && year > 0; year-- {
+		cy := CalendarYear{Year: year}
+		first := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+		start := first.AddDate(0, 0, -int(first.Weekday()))
+		for t := start; t.Year() <= year; t = t.AddDate(0, 0, 1) {
+			day := CalendarDay{Date: t, Valid: t.Year() == year}
+			if day.Valid {
+				day.Count = counts[t.Format(dateLayout)]
+				if day.Count > 0 {
+					// 1..4 in proportion to the busiest day.
+					day.Level = (day.Count*4 + maxCount - 1) / maxCount
+					day.URL = urlOf(t)
+				}
+			}
+			w := int(t.Weekday())
+			cy.Rows[w] = append(cy.Rows[w], day)
+		}
+		// pad the last week.
+		for w := range cy.Rows {
+			if len(cy.Rows[w]) < len(cy.Rows[0]) {
+				cy.Rows[w] = append(cy.Rows[w], CalendarDay{})
+			}
+		}
+		years = append(years, cy)
+	}
+	return years
+}
+
+// DayPage : 日毎のページのための情報。
+// Prev/Nextは同じ月で前後に投稿がある日で、なければ0である。
+type DayPage struct {
+	Day  int
+	Prev int
+	Next int
+}
+
+func (d DayPage) Dir() string {
+	return fmt.Sprintf("%02d", d.Day)
+}
+
+func (d DayPage) PrevDir() string {
+	return fmt.Sprintf("%02d", d.Prev)
+}
+
+func (d DayPage) NextDir() string {
+	return fmt.Sprintf("%02d", d.Next)
+}
+
+// splitByDay : 投稿時刻順に並んだmsgsを日毎に分ける。
+// 各日のメッセージは新しいスライスにコピーし、Trailを付け直す。
+func splitByDay(msgs []Message) ([]int, map[int][]Message) {
+	var days []int
+	perDay := map[int][]Message{}
+	for _, msg := range msgs {
+		day := TsToDateTime(msg.Ts).Day()
+		if _, ok := perDay[day]; !ok {
+			days = append(days, day)
+		}
+		perDay[day] = append(perDay[day], msg)
+	}
+	sort.Ints(days)
+	for _, msgs := range perDay {
+		markTrail(msgs)
+	}
+	return days, perDay
+}
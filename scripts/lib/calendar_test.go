@@ -0,0 +1,68 @@
+package slacklog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestCalendarReplyOnlyDay : 返信のみの日のカレンダーのリンクが、生成したペー
+// ジを指すことを確かめる。
+func TestCalendarReplyOnlyDay(t *testing.T) {
+	if err := SetTimezone(""); err != nil {
+		t.Fatal(err)
+	}
+	// 2020-01-01, 2020-01-03 and 2020-02-05 in Asia/Tokyo
+	const (
+		root    = "1577836800.000100"
+		reply1  = "1578009600.000200"
+		reply2  = "1580860800.000300"
+		another = "1577840400.000400"
+	)
+	for _, dayPages := range []bool{false, true} {
+		s := NewMemoryLogStore()
+		s.AddUsers(User{ID: "U1", Name: "alice"})
+		s.AddChannels(Channel{ID: "C1", Name: "general"})
+		err := s.AddMessages("C1",
+			Message{User: "U1", Text: "root", Ts: root, ThreadTs: root},
+			Message{User: "U1", Text: "other", Ts: another},
+			Message{User: "U1", Text: "reply", Ts: reply1, ThreadTs: root},
+			Message{User: "U1", Text: "late reply", Ts: reply2, ThreadTs: root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := DefaultConfig()
+		cfg.DayPages = dayPages
+		outDir := t.TempDir()
+		if err := NewHTMLGenerator("", s, cfg).Generate(context.Background(), outDir); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(filepath.Join(outDir, "C1", "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hrefs := regexp.MustCompile(`<td class='slacklog-calendar-level\d'><a href='([^']*)'`).FindAllStringSubmatch(string(b), -1)
+		if len(hrefs) != 3 {
+			t.Fatalf("DayPages=%v: %d days are linked, want 3", dayPages, len(hrefs))
+		}
+		for _, m := range hrefs {
+			u := strings.TrimPrefix(m[1], "{{ site.baseurl }}/")
+			path, anchor, _ := strings.Cut(u, "#")
+			if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(path), "index.html")); err != nil {
+				t.Errorf("DayPages=%v: %s links to a page not generated: %v", dayPages, m[1], err)
+			}
+			if !strings.HasPrefix(path, "C1/2020/01/") {
+				t.Errorf("DayPages=%v: %s does not link to the page of the root", dayPages, m[1])
+			}
+			if anchor != "" && anchor != "ts-"+reply1 && anchor != "ts-"+reply2 {
+				t.Errorf("DayPages=%v: %s links to an unexpected message", dayPages, m[1])
+			}
+		}
+		if !strings.Contains(string(b), "#ts-"+reply1) || !strings.Contains(string(b), "#ts-"+reply2) {
+			t.Errorf("DayPages=%v: reply-only days do not link to the replies", dayPages)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package slacklog
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultLocale : ページの言語の既定値
+const DefaultLocale = "ja"
+
+// Catalog : テンプレートのUI文字列。キーはメッセージIDで、値は引数を
+// fmt.Sprintf()で埋め込む書式である。"layout."で始まるキーの値は日時の
+// time.Formatの書式である。
+// 値はそのままHTMLとして出力するため、必要に応じてエスケープしておくこと。
+type Catalog map[string]string
+
+// T : keyの文字列にargsを埋め込んで返す。keyがなければkeyをそのまま返す。
+func (c Catalog) T(key string, args ...interface{}) string {
+	format, ok := c[key]
+	if !ok {
+		slog.Warn("unknown message", "key", key)
+		return key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Format : tをlayoutKeyの書式で文字列にする。
+func (c Catalog) Format(layoutKey string, t time.Time) string {
+	return t.Format(c.T(layoutKey))
+}
+
+// catalogOf : localeのカタログを返す。localeが空ならDefaultLocaleのカタログを
+// 返す。
+func catalogOf(locale string) Catalog {
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	return catalogs[locale]
+}
+
+// Locales : カタログのある言語を返す。
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// toInt : テンプレートに渡された文字列または整数の年月日を整数にする。
+func toInt(v interface{}) int {
+	switch v := v.(type) {
+	case int:
+		return v
+	case time.Month:
+		return int(v)
+	}
+	n, _ := strconv.Atoi(fmt.Sprint(v))
+	return n
+}
+
+// dateFuncs : 言語に合わせて日付を表示するテンプレートの関数。
+// 年月日は文字列("2020", "01")と整数のどちらでもよい。
+func (c Catalog) dateFuncs() map[string]interface{} {
+	date := func(y, m, d interface{}) time.Time {
+		return time.Date(toInt(y), time.Month(toInt(m)), toInt(d), 0, 0, 0, 0, time.UTC)
+	}
+	return map[string]interface{}{
+		"date": func(t time.Time) string {
+			return c.Format("layout.date", t)
+		},
+		"year": func(y interface{}) string {
+			return c.Format("layout.year", date(y, 1, 1))
+		},
+		"yearMonth": func(y, m interface{}) string {
+			return c.Format("layout.yearMonth", date(y, m, 1))
+		},
+		"monthDay": func(y, m, d interface{}) string {
+			return c.Format("layout.monthDay", date(y, m, d))
+		},
+		"fullDay": func(y, m, d interface{}) string {
+			return c.Format("layout.fullDay", date(y, m, d))
+		},
+	}
+}
+
+// catalogs : 言語毎のUI文字列
+var catalogs = map[string]Catalog{
+	"ja": {
+		"locale.name": "日本語",
+
+		// dates
+		"layout.date":       "2006年1月2日",
+		"layout.dateTime":   "2006年1月2日 15:04:05",
+		"layout.dateMinute": "2006年1月2日 15:04",
+		"layout.dayTime":    "2日 15:04:05",
+		"layout.time":       "15:04:05",
+		"layout.year":       "2006年",
+		"layout.yearMonth":  "2006年01月",
+		"layout.monthDay":   "02日",
+		"layout.fullDay":    "2006年01月02日",
+
+		// navigation
+		"nav.members":   "メンバー",
+		"nav.timeline":  "タイムライン",
+		"nav.stats":     "統計",
+		"nav.prevPage":  "前のページ",
+		"nav.nextPage":  "次のページ",
+		"nav.permalink": "Slackのリンクから探す",
+
+		// top and channel pages
+		"about.intro":    "参加方法、各チャンネルの概要等は以下を参照して下さい。",
+		"about.link":     "%sのチャットルームについて",
+		"count.messages": "%d件",
+
+		// messages
+		"message.repliedTo":   "このスレッドに返信しました",
+		"message.replies":     "%d 件の返信",
+		"message.lastReply":   "最終返信",
+		"message.broadcasted": "チャンネルにも投稿済",
+		"message.rootMissing": "(元のメッセージはありません)",
+		"file.external":       "外部ファイル",
+		"file.download":       "ダウンロード",
+		"snippet.more":        "残り%d行を表示",
+		"snippet.download":    "全体をダウンロード",
+
+		// threads
+		"thread.participants":   "%d 人が参加",
+		"thread.continuesIn":    "次の月に続く",
+		"thread.continuedFrom":  "前の月から続くスレッド",
+		"thread.repliesInMonth": "この月に %d 件の返信",
+
+		// permalink lookup
+		"permalink.description": "Slackのメッセージのリンク(「リンクをコピー」で得られるURL)を入力すると、このアーカイブのそのメッセージのページに移動します。",
+		"permalink.submit":      "移動",
+		"permalink.notFound":    "このアーカイブにはないメッセージです。",
+
+		// timeline
+		"timeline.description": "全チャンネルの投稿を日毎にまとめています。",
+
+		// users
+		"user.title":          "肩書き",
+		"user.timezone":       "タイムゾーン",
+		"user.messages":       "投稿数",
+		"user.messageReplies": "%d (うちスレッドへの返信 %d)",
+		"user.channels":       "投稿したチャンネル",
+		"user.recent":         "最近の投稿",
+
+		// stats
+		"stats.months":     "月別の投稿数",
+		"stats.channels":   "チャンネル別の投稿数",
+		"stats.messages":   "投稿",
+		"stats.threads":    "スレッド",
+		"stats.avgReplies": "平均返信数",
+		"stats.maxReplies": "最大返信数",
+		"stats.users":      "投稿数の多いユーザー",
+		"stats.emojis":     "よく使われる絵文字",
+		"stats.reactions":  "リアクション",
+		"stats.inText":     "本文",
+		"stats.filetypes":  "ファイル形式別のアップロード",
+		"stats.files":      "件数",
+		"stats.bytes":      "合計サイズ",
+	},
+	"en": {
+		"locale.name": "English",
+
+		// dates
+		"layout.date":       "Jan 2, 2006",
+		"layout.dateTime":   "Jan 2, 2006 15:04:05",
+		"layout.dateMinute": "Jan 2, 2006 15:04",
+		"layout.dayTime":    "Jan 2 15:04:05",
+		"layout.time":       "15:04:05",
+		"layout.year":       "2006",
+		"layout.yearMonth":  "January 2006",
+		"layout.monthDay":   "Jan 2",
+		"layout.fullDay":    "January 2, 2006",
+
+		// navigation
+		"nav.members":   "Members",
+		"nav.timeline":  "Timeline",
+		"nav.stats":     "Stats",
+		"nav.prevPage":  "Previous page",
+		"nav.nextPage":  "Next page",
+		"nav.permalink": "Find a Slack link",
+
+		// top and channel pages
+		"about.intro":    "See the following page for how to join and the overview of each channel.",
+		"about.link":     "About the %s chat room",
+		"count.messages": "%d messages",
+
+		// messages
+		"message.repliedTo":   "replied to a thread",
+		"message.replies":     "%d replies",
+		"message.lastReply":   "Last reply",
+		"message.broadcasted": "Also sent to the channel",
+		"message.rootMissing": "(original message unavailable)",
+		"file.external":       "External file",
+		"file.download":       "Download",
+		"snippet.more":        "Show %d more lines",
+		"snippet.download":    "Download the whole file",
+
+		// threads
+		"thread.participants":   "%d participants",
+		"thread.continuesIn":    "Continues in",
+		"thread.continuedFrom":  "Threads continued from earlier months",
+		"thread.repliesInMonth": "%d replies this month",
+
+		// permalink lookup
+		"permalink.description": "Enter the link to a Slack message (the URL from \"Copy link\") to go to the message in this archive.",
+		"permalink.submit":      "Go",
+		"permalink.notFound":    "The message is not in this archive.",
+
+		// timeline
+		"timeline.description": "Messages of all channels by day.",
+
+		// users
+		"user.title":          "Title",
+		"user.timezone":       "Time zone",
+		"user.messages":       "Messages",
+		"user.messageReplies": "%d (%d replies in threads)",
+		"user.channels":       "Channels",
+		"user.recent":         "Recent messages",
+
+		// stats
+		"stats.months":     "Messages by month",
+		"stats.channels":   "Messages by channel",
+		"stats.messages":   "Messages",
+		"stats.threads":    "Threads",
+		"stats.avgReplies": "Avg. replies",
+		"stats.maxReplies": "Max replies",
+		"stats.users":      "Top posters",
+		"stats.emojis":     "Popular emojis",
+		"stats.reactions":  "Reactions",
+		"stats.inText":     "In text",
+		"stats.filetypes":  "Uploads by file type",
+		"stats.files":      "Files",
+		"stats.bytes":      "Total size",
+	},
+}
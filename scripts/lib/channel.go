@@ -21,6 +21,10 @@ func NewChannelTable(path string, whitelist []string) (*ChannelTable, error) {
 	if err := ReadFileAsJSON(path, &channels); err != nil {
 		return nil, err
 	}
+	return newChannelTable(channels, whitelist), nil
+}
+
+func newChannelTable(channels []Channel, whitelist []string) *ChannelTable {
 	channels = FilterChannel(channels, whitelist)
 	sort.Slice(channels, func(i, j int) bool {
 		return channels[i].Name < channels[j].Name
@@ -32,7 +36,7 @@ func NewChannelTable(path string, whitelist []string) (*ChannelTable, error) {
 	return &ChannelTable{
 		Channels:   channels,
 		ChannelMap: channelMap,
-	}, nil
+	}
 }
 
 // FilterChannel : whitelistに指定したチャンネル名に該当するチャンネルのみを返
@@ -0,0 +1,356 @@
+package slacklog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// checkで報告する問題の種類
+const (
+	// ダウンロードされていないファイル、またはページから参照しているが存在しな
+	// いファイル
+	CheckMissingFile = "missing-file"
+	// 画像が存在しない、または別名の解決できないカスタム絵文字
+	CheckMissingEmoji = "missing-emoji"
+	// 出力対象でないチャンネルへのリンク
+	CheckDanglingChannel = "dangling-channel"
+	// 表示名の解決できないユーザへのメンション、またはメッセージの投稿者
+	CheckUnresolvedUser = "unresolved-user"
+	// ページから参照しているが出力されていないページ
+	CheckMissingPage = "missing-page"
+	// ページから参照しているが存在しない#ts-のアンカー
+	CheckMissingAnchor = "missing-anchor"
+)
+
+var (
+	reCheckMention = regexp.MustCompile(`<@([A-Z0-9]+)(?:\|[^>]*)?>`)
+	reCheckChannel = regexp.MustCompile(`<#([A-Z0-9]+)(?:\|([^>]*))?>`)
+	reCheckRef     = regexp.MustCompile(`(?:href|src)=["']\{\{ site\.baseurl \}\}/([^"'#]*)(?:#ts-([0-9.]+))?["']`)
+	reCheckLocal   = regexp.MustCompile(`href=["']#ts-([0-9.]+)["']`)
+	reCheckID      = regexp.MustCompile(`id=["']ts-([0-9.]+)["']`)
+	reChannelID    = regexp.MustCompile(`^[CDG][A-Z0-9]+$`)
+)
+
+// CheckIssue : checkで見つかった問題。
+type CheckIssue struct {
+	Kind string
+	// 問題の対象。ファイルのパス、絵文字名、チャンネルやユーザのIDなど
+	Detail string
+	// 最初に見つかったメッセージのチャンネルとts。ページの問題では空となる。
+	ChannelID string
+	Ts        string
+	// 最初に見つかったページの、出力先からのパス。メッセージの問題では空となる。
+	Page string
+	// 同じ問題が見つかった回数
+	Count int
+}
+
+func (i CheckIssue) String() string {
+	where := i.Page
+	if i.ChannelID != "" {
+		where = i.ChannelID + " " + i.Ts
+	}
+	s := fmt.Sprintf("[%s] %s (%s)", i.Kind, i.Detail, where)
+	if i.Count > 1 {
+		s += fmt.Sprintf(" and %d more", i.Count-1)
+	}
+	return s
+}
+
+// Checker : ログデータと生成したページの参照切れを調べる。
+type Checker struct {
+	s LogStore
+	// download-filesの保存先。空なら添付ファイルは調べない。
+	FilesDir string
+	// download-emojiの保存先。空なら絵文字の画像は調べない。
+	EmojisDir string
+	// generate-htmlの出力先。空ならページは調べない。
+	OutDir string
+
+	// key: channel ID
+	channels map[string]bool
+	emojis   map[string]string
+	issues   map[string]*CheckIssue
+}
+
+// NewChecker : Checkerを生成する。
+func NewChecker(s LogStore) *Checker {
+	return &Checker{s: s}
+}
+
+// Run : 調べた問題を種類と対象の順に返す。
+// 同じ問題は最初に見つかった箇所とその回数にまとめる。
+func (c *Checker) Run(ctx context.Context) ([]CheckIssue, error) {
+	c.channels = map[string]bool{}
+	for _, channel := range c.s.GetChannels() {
+		c.channels[channel.ID] = true
+	}
+	c.emojis = c.s.GetEmojiMap()
+	c.issues = map[string]*CheckIssue{}
+
+	if err := c.checkData(ctx); err != nil {
+		return nil, err
+	}
+	if c.OutDir != "" {
+		if err := c.checkPages(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	issues := make([]CheckIssue, 0, len(c.issues))
+	for _, i := range c.issues {
+		issues = append(issues, *i)
+	}
+	sort.Slice(issues, func(a, b int) bool {
+		if issues[a].Kind != issues[b].Kind {
+			return issues[a].Kind < issues[b].Kind
+		}
+		return issues[a].Detail < issues[b].Detail
+	})
+	return issues, nil
+}
+
+func (c *Checker) report(issue CheckIssue) {
+	key := issue.Kind + "\x00" + issue.Detail
+	if i, ok := c.issues[key]; ok {
+		i.Count++
+		return
+	}
+	issue.Count = 1
+	c.issues[key] = &issue
+}
+
+// checkData : 全てのチャンネルのメッセージを月毎に読み込んで調べる。
+func (c *Checker) checkData(ctx context.Context) error {
+	for _, channel := range c.s.GetChannels() {
+		keys, err := c.s.GetMonthKeys(channel.ID)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			msgs, err := c.s.GetMessagesOfMonth(channel.ID, key)
+			if err != nil {
+				return err
+			}
+			for _, msg := range msgs {
+				c.checkMessage(channel.ID, msg)
+				if !msg.IsRootOfThread() {
+					continue
+				}
+				if t, ok := c.s.GetThread(channel.ID, msg.Ts); ok {
+					for _, reply := range t.Replies() {
+						c.checkMessage(channel.ID, reply)
+					}
+				}
+			}
+			c.s.ReleaseMonth(channel.ID, key)
+		}
+	}
+	return nil
+}
+
+func (c *Checker) checkMessage(channelID string, msg Message) {
+	at := func(kind, detail string) {
+		c.report(CheckIssue{Kind: kind, Detail: detail, ChannelID: channelID, Ts: msg.Ts})
+	}
+
+	// messages of apps are shown with the bot identity.
+	if msg.User != "" && !msg.IsBotMessage() && msg.BotID == "" {
+		if _, ok := c.s.GetUserByID(msg.User); !ok {
+			at(CheckUnresolvedUser, msg.User)
+		}
+	}
+
+	texts := []string{msg.Text}
+	for _, a := range msg.Attachments {
+		texts = append(texts, a.Pretext, a.Text)
+	}
+	for _, text := range texts {
+		for _, m := range reCheckMention.FindAllStringSubmatch(text, -1) {
+			if c.s.GetDisplayNameByUserID(m[1]) == "" {
+				at(CheckUnresolvedUser, m[1])
+			}
+		}
+		for _, m := range reCheckChannel.FindAllStringSubmatch(text, -1) {
+			if !c.channels[m[1]] {
+				at(CheckDanglingChannel, strings.TrimSpace(m[1]+" #"+m[2]))
+			}
+		}
+		for _, exp := range reEmoji.FindAllString(text, -1) {
+			if name, ok := c.missingEmoji(exp[1 : len(exp)-1]); ok {
+				at(CheckMissingEmoji, name)
+			}
+		}
+	}
+
+	if c.FilesDir == "" {
+		return
+	}
+	for _, f := range msg.Files {
+		if f.IsExternal {
+			continue
+		}
+		for _, d := range f.DownloadURLsAndSuffixes() {
+			name := f.DownloadFilename(d.URL, d.Suffix)
+			if !exists(filepath.Join(c.FilesDir, f.ID, name)) {
+				at(CheckMissingFile, f.ID+"/"+name)
+			}
+		}
+	}
+}
+
+// missingEmoji : カスタム絵文字nameの別名が解決できない、または画像が存在しな
+// い場合に、その絵文字名を返す。
+// カスタム絵文字でない名前は、Unicodeの絵文字か単なるテキストであるため調べない。
+func (c *Checker) missingEmoji(name string) (string, bool) {
+	ext, ok := c.emojis[name]
+	if !ok {
+		return "", false
+	}
+	for strings.HasPrefix(ext, "alias:") {
+		name = ext[len("alias:"):]
+		ext, ok = c.emojis[name]
+		if !ok {
+			return name, true
+		}
+	}
+	if c.EmojisDir == "" {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(c.EmojisDir, name+ext)); err != nil {
+		return name, true
+	}
+	return "", false
+}
+
+// checkedPage : 出力先のページから集めたアンカーと参照。
+type checkedPage struct {
+	ids   map[string]bool
+	refs  [][]string
+	local []string
+}
+
+// checkPages : 出力先のページが参照しているファイル、ページ、アンカーが存在す
+// るかを調べる。
+func (c *Checker) checkPages(ctx context.Context) error {
+	pages := map[string]*checkedPage{}
+	err := filepath.WalkDir(c.OutDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".html" {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.OutDir, p)
+		if err != nil {
+			return err
+		}
+		page := &checkedPage{ids: map[string]bool{}, refs: reCheckRef.FindAllStringSubmatch(string(b), -1)}
+		for _, m := range reCheckID.FindAllStringSubmatch(string(b), -1) {
+			page.ids[m[1]] = true
+		}
+		for _, m := range reCheckLocal.FindAllStringSubmatch(string(b), -1) {
+			page.local = append(page.local, m[1])
+		}
+		pages[filepath.ToSlash(rel)] = page
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read pages in %s: %w", c.OutDir, err)
+	}
+
+	names := make([]string, 0, len(pages))
+	for name := range pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tsMaps := map[string]map[string]string{}
+	for _, name := range names {
+		page := pages[name]
+		at := func(kind, detail string) {
+			c.report(CheckIssue{Kind: kind, Detail: detail, Page: name})
+		}
+		for _, ts := range page.local {
+			if !page.ids[ts] {
+				at(CheckMissingAnchor, name+"#ts-"+ts)
+			}
+		}
+		for _, m := range page.refs {
+			ref, err := url.PathUnescape(m[1])
+			if err != nil {
+				ref = m[1]
+			}
+			switch first, _, _ := strings.Cut(ref, "/"); first {
+			case "files":
+				if c.FilesDir != "" && !exists(filepath.Join(c.FilesDir, filepath.FromSlash(ref[len("files/"):]))) {
+					at(CheckMissingFile, ref[len("files/"):])
+				}
+				continue
+			case "emojis":
+				if c.EmojisDir != "" && !exists(filepath.Join(c.EmojisDir, filepath.FromSlash(ref[len("emojis/"):]))) {
+					name := ref[len("emojis/"):]
+					at(CheckMissingEmoji, strings.TrimSuffix(name, path.Ext(name)))
+				}
+				continue
+			case "assets", "docs":
+				// static files of the site.
+				continue
+			}
+			target := ref
+			if target == "" || strings.HasSuffix(target, "/") {
+				target = path.Join(target, "index.html")
+			}
+			target = strings.TrimPrefix(target, "/")
+			linked, ok := pages[target]
+			if !ok && !exists(filepath.Join(c.OutDir, filepath.FromSlash(target))) {
+				if first, _, _ := strings.Cut(ref, "/"); reChannelID.MatchString(first) && !c.channels[first] {
+					at(CheckDanglingChannel, first)
+				} else {
+					at(CheckMissingPage, ref)
+				}
+				continue
+			}
+			if ts := m[2]; ts != "" && (linked == nil || !linked.ids[ts]) && !c.inTsMap(tsMaps, path.Dir(target), ts) {
+				at(CheckMissingAnchor, ref+"#ts-"+ts)
+			}
+		}
+	}
+	return nil
+}
+
+// inTsMap : ページを分けた月のdirのts.jsonにtsが含まれるかを返す。
+func (c *Checker) inTsMap(cache map[string]map[string]string, dir, ts string) bool {
+	m, ok := cache[dir]
+	if !ok {
+		if b, err := os.ReadFile(filepath.Join(c.OutDir, filepath.FromSlash(dir), tsMapFilename)); err == nil {
+			json.Unmarshal(b, &m)
+		}
+		cache[dir] = m
+	}
+	_, ok = m[ts]
+	return ok
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
@@ -1,17 +1,296 @@
 package slacklog
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigEnvPrefix : コンフィグの各項目を上書きする環境変数の接頭辞。
+// 例えばworkersは$SLACKLOG_WORKERSで上書きできる。
+const ConfigEnvPrefix = "SLACKLOG_"
+
 // Config : ログ出力時の設定を保持する。
+// 各項目はDefaultConfig()の既定値、コンフィグファイル、環境変数、フラグの順に
+// 上書きされる。パスはコマンドを実行したディレクトリからの相対パスとなる。
 type Config struct {
-	EditedSuffix  string   `json:"edited_suffix"`
-	Channels      []string `json:"channels"`
-	EmojiJSONPath string   `json:"emoji_json_path"`
+	EditedSuffix string   `json:"edited_suffix"`
+	Channels     []string `json:"channels"`
+	// ログデータのディレクトリからの絵文字の一覧(emoji.json)のパス
+	EmojiJSONPath string `json:"emoji_json_path"`
+	// generate-htmlでページを並列に生成するワーカーの数。0以下ならCPU数となる。
+	Workers int `json:"workers"`
+	// trueの場合、generate-htmlで統計ページ(stats/index.html)も生成する。
+	StatsPage bool `json:"stats_page"`
+	// ユーザページを生成せず、投稿者名からリンクもしないユーザのID
+	RedactedUsers []string `json:"redacted_users"`
+	// trueの場合、月毎のページに加えて日毎のページ(${MM}/${DD}/index.html)も生成
+	// する。
+	DayPages bool `json:"day_pages"`
+	// trueの場合、全チャンネルのメッセージを日毎にまとめたタイムライン
+	// (timeline/)を生成する。
+	TimelinePages bool `json:"timeline_pages"`
+	// 月毎のページに表示するメッセージの最大数。これを超える月はpage/${N}/に
+	// 分ける。0以下なら分けない。
+	MessagesPerPage int `json:"messages_per_page"`
+	// download-filesで添付ファイルをダウンロードしたディレクトリ。コードのスニペッ
+	// トなどの内容をページに埋め込むために読み込む。空なら読み込まない。
+	FilesDir string `json:"files_dir"`
+	// コードのスニペットの最初に表示する行数。0以下ならdefaultSnippetLinesとな
+	// る。
+	SnippetLines int `json:"snippet_lines"`
+	// メッセージの日付を判定するタイムゾーン。空ならDefaultTimezoneとなる。
+	Timezone string `json:"timezone"`
+
+	// convert-exported-logsで変換する、Slackからエクスポートしたデータのディレ
+	// クトリ
+	ExportDir string `json:"export_dir"`
+	// ログデータのディレクトリ、またはbuild-dbで生成したデータベースのファイル
+	LogDir string `json:"log_dir"`
+	// build-dbで生成するデータベースのファイル
+	DBFile string `json:"db_file"`
+	// generate-htmlで組み込みのテンプレートより優先するテンプレートのディレク
+	// トリ。空なら組み込みのテンプレートのみを用いる。
+	TemplateDir string `json:"template_dir"`
+	// generate-htmlの出力先のディレクトリ
+	OutDir string `json:"out_dir"`
+	// generate-htmlでレイアウトやCSSなどのサイトのファイルを書き出すディレクト
+	// リ。空ならOutDirに書き出し、生成したページと合わせて一つのサイトとする。
+	SiteDir string `json:"site_dir"`
+	// download-emojiで絵文字の画像を保存するディレクトリ
+	EmojisDir string `json:"emojis_dir"`
+
+	// 生成するサイトのタイトル
+	SiteTitle string `json:"site_title"`
+	// 生成したページを公開するURL
+	SiteURL string `json:"site_url"`
+	// ログを取得したSlackのワークスペースの名前
+	WorkspaceName string `json:"workspace_name"`
+	// ログを取得したSlackのワークスペースのドメイン
+	WorkspaceDomain string `json:"workspace_domain"`
+	// Slackのメッセージへのリンクの書式。{domain}はWorkspaceDomainに、
+	// {channel}はチャンネルIDに、{ts}は"."を除いたtsに置き換える。
+	PermalinkFormat string `json:"permalink_format"`
+	// 参加方法などを説明するページのURL。空ならリンクしない。
+	AboutURL string `json:"about_url"`
+	// 生成するページの言語。Locales()のいずれか。
+	Locale string `json:"locale"`
+	// Localeのページに加えて${locale}/以下に生成する言語
+	ExtraLocales []string `json:"extra_locales"`
+
+	// SlackのAPIのトークン。秘密の情報であるため、コンフィグファイルではなく環
+	// 境変数$SLACK_TOKENからのみ読み込む。
+	SlackToken string `json:"-"`
+}
+
+// DefaultConfig : 既定値のコンフィグを返す。
+func DefaultConfig() *Config {
+	return &Config{
+		Channels:        []string{"*"},
+		EmojiJSONPath:   "emoji.json",
+		Timezone:        DefaultTimezone,
+		SiteTitle:       "vim-jp.slack.com log",
+		SiteURL:         "https://vim-jp.org/slacklog",
+		WorkspaceName:   "vim-jp",
+		WorkspaceDomain: "vim-jp.slack.com",
+		PermalinkFormat: DefaultPermalinkFormat,
+		AboutURL:        "/docs/chat.html",
+		Locale:          DefaultLocale,
+	}
+}
+
+// ConfigError : コンフィグの項目の値が正しくない。
+type ConfigError struct {
+	// 項目のJSONのキー
+	Field string
+	// 値の指定元。コンフィグファイルのパス、環境変数名、フラグ名など
+	Source string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("invalid config %s: %s", e.Field, e.Err)
+	}
+	return fmt.Sprintf("invalid config %s (from %s): %s", e.Field, e.Source, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
 }
 
-// ReadConfig : pathに指定したファイルからコンフィグを読み込む。
+// ReadConfig : 既定値のコンフィグをpathに指定したファイルで上書きして返す。
+// 未知の項目や型の合わない値はその項目を示すエラーとする。
 func ReadConfig(path string) (*Config, error) {
-	var cfg Config
-	if err := ReadFileAsJSON(path, &cfg); err != nil {
+	cfg := DefaultConfig()
+	b, err := os.ReadFile(path)
+	if err != nil {
 		return nil, err
 	}
-	return &cfg, nil
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		var te *json.UnmarshalTypeError
+		if errors.As(err, &te) {
+			return nil, &ConfigError{Field: te.Field, Source: path, Err: fmt.Errorf("must be %s, not %s", te.Type, te.Value)}
+		}
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return nil, &ConfigError{Field: strings.Trim(field, `"`), Source: path, Err: errors.New("unknown field")}
+		}
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ConfigKeys : コンフィグの全ての項目のJSONのキーを返す。
+func ConfigKeys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if key := configKey(t.Field(i)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func configKey(f reflect.StructField) string {
+	key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+// configField : JSONのキーがkeyの項目を返す。
+func (c *Config) configField(key string) (reflect.Value, bool) {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if configKey(v.Type().Field(i)) == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// Set : JSONのキーがkeyの項目を文字列のvalueから設定する。
+// リストの項目はカンマで区切った値とする。sourceはエラーに示す値の指定元。
+func (c *Config) Set(key, value, source string) error {
+	field, ok := c.configField(key)
+	if !ok {
+		return &ConfigError{Field: key, Source: source, Err: errors.New("unknown field")}
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return &ConfigError{Field: key, Source: source, Err: fmt.Errorf("must be an integer, not %q", value)}
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return &ConfigError{Field: key, Source: source, Err: fmt.Errorf("must be true or false, not %q", value)}
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		var list []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		panic("unsupported config field type: " + field.Kind().String())
+	}
+	return nil
+}
+
+// ApplyEnv : ConfigEnvPrefixに項目のキーを大文字にして続けた環境変数で各項目を
+// 上書きする。SlackTokenは$SLACK_TOKENから読み込む。
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, key := range ConfigKeys() {
+		name := ConfigEnvPrefix + strings.ToUpper(key)
+		if value, ok := lookup(name); ok {
+			if err := c.Set(key, value, "$"+name); err != nil {
+				return err
+			}
+		}
+	}
+	if token, ok := lookup("SLACK_TOKEN"); ok {
+		c.SlackToken = token
+	}
+	return nil
+}
+
+var reDomain = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// Validate : 各項目の値を検証し、正しくない最初の項目を*ConfigErrorとして返す。
+func (c *Config) Validate() error {
+	invalid := func(key string, format string, args ...interface{}) error {
+		return &ConfigError{Field: key, Err: fmt.Errorf(format, args...)}
+	}
+	for _, ch := range c.Channels {
+		if ch == "" {
+			return invalid("channels", "must not contain an empty name")
+		}
+	}
+	if c.Workers < 0 {
+		return invalid("workers", "must not be negative")
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return invalid("timezone", "unknown time zone %q", c.Timezone)
+		}
+	}
+	if c.SiteURL != "" {
+		u, err := url.Parse(c.SiteURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalid("site_url", "must be an absolute http(s) URL, not %q", c.SiteURL)
+		}
+	}
+	if c.WorkspaceDomain != "" && !reDomain.MatchString(c.WorkspaceDomain) {
+		return invalid("workspace_domain", "must be a domain name like example.slack.com, not %q", c.WorkspaceDomain)
+	}
+	if _, ok := catalogs[c.Locale]; c.Locale != "" && !ok {
+		return invalid("locale", "must be one of %s, not %q", strings.Join(Locales(), ", "), c.Locale)
+	}
+	for _, l := range c.ExtraLocales {
+		if _, ok := catalogs[l]; !ok {
+			return invalid("extra_locales", "must be some of %s, not %q", strings.Join(Locales(), ", "), l)
+		}
+		if l == c.Locale {
+			return invalid("extra_locales", "must not contain the locale %q", l)
+		}
+	}
+	if c.PermalinkFormat != "" && (!strings.Contains(c.PermalinkFormat, "{channel}") || !strings.Contains(c.PermalinkFormat, "{ts}")) {
+		return invalid("permalink_format", "must contain {channel} and {ts}, not %q", c.PermalinkFormat)
+	}
+	return nil
+}
+
+// Require : keysの項目が空でないことを検証する。
+func (c *Config) Require(keys ...string) error {
+	for _, key := range keys {
+		field, ok := c.configField(key)
+		if !ok {
+			panic("unknown config field: " + key)
+		}
+		if field.IsZero() || field.Kind() == reflect.Slice && field.Len() == 0 {
+			name := strings.ReplaceAll(key, "_", "-")
+			return &ConfigError{Field: key, Err: fmt.Errorf("required: set it in the config file, $%s%s or -%s", ConfigEnvPrefix, strings.ToUpper(key), name)}
+		}
+	}
+	return nil
 }
@@ -9,6 +9,9 @@ import (
 	"github.com/kyokomi/emoji"
 )
 
+// reEmoji : テキスト中の":name:"形式の絵文字にマッチする。
+var reEmoji = regexp.MustCompile(`:[^\s!"#$%&()=^/?\\\[\]<>,.;@{}~:]+:`)
+
 // TextConverter : markdown形式のテキストをHTMLに変換するための構造体。
 type TextConverter struct {
 	// key: emoji name
@@ -17,14 +20,17 @@ type TextConverter struct {
 	// key: user ID
 	// value: display name
 	users map[string]string
-	re    regexps
+	// Slackのメッセージへのリンクをアーカイブのページへのリンクに置き換えるた
+	// めの索引。nilなら置き換えない。
+	permalinks *permalinkIndex
+	re         regexps
 }
 
 // NewTextConverter : TextConverter を生成する
 func NewTextConverter(users, emojis map[string]string) *TextConverter {
 	re := regexps{}
 	// TODO tokenize/parse message.Text
-	re.linkWithTitle = regexp.MustCompile(`&lt;(https?://[^>]+?\|(.+?))&gt;`)
+	re.linkWithTitle = regexp.MustCompile(`&lt;(https?://[^>]+?)\|(.+?)&gt;`)
 	re.link = regexp.MustCompile(`&lt;(https?://[^>]+?)&gt;`)
 	// go regexp does not support back reference
 	re.code = regexp.MustCompile("`{3}|｀{3}")
@@ -32,7 +38,7 @@ func NewTextConverter(users, emojis map[string]string) *TextConverter {
 	re.del = regexp.MustCompile(`~([^~]+?)~`)
 	re.mention = regexp.MustCompile(`&lt;@(\w+?)&gt;`)
 	re.channel = regexp.MustCompile(`&lt;#([^|]+?)\|([^&]+?)&gt;`)
-	re.emoji = regexp.MustCompile(`:[^\s!"#$%&()=^/?\\\[\]<>,.;@{}~:]+:`)
+	re.emoji = reEmoji
 	re.newLine = regexp.MustCompile(`\n`)
 
 	return &TextConverter{
@@ -98,6 +104,18 @@ func (c *TextConverter) bindChannel(channelExp string) string {
 	return "<a href='{{ site.baseurl }}/" + channelId + "/'>#" + channelName + "</a>"
 }
 
+// codeBlock : エスケープ済みのコードブロックの中身sを<pre>にする。
+// 言語が判定できればシンタックスハイライトする。
+func (c *TextConverter) codeBlock(s string) string {
+	code := html.UnescapeString(strings.Replace(s, "<br>", "\n", -1))
+	if lexer, code := detectCodeLexer(code); lexer != nil {
+		if h, ok := highlightCode(code, lexer, false, 1); ok {
+			return h
+		}
+	}
+	return "<pre>" + s + "</pre>"
+}
+
 // ToHTML : markdown形式のtextをHTMLに変換する
 func (c *TextConverter) ToHTML(text string) string {
 	text = c.escapeSpecialChars(text)
@@ -113,9 +131,9 @@ func (c *TextConverter) ToHTML(text string) string {
 			s = c.re.mention.ReplaceAllStringFunc(s, c.bindUser)
 			s = c.re.channel.ReplaceAllStringFunc(s, c.bindChannel)
 		} else {
-			s = "<pre>" + s + "</pre>"
+			s = c.codeBlock(s)
 		}
 		chunks[i] = s
 	}
-	return strings.Join(chunks, "")
+	return c.permalinks.rewriteLinks(strings.Join(chunks, ""))
 }
@@ -0,0 +1,20 @@
+package slacklog
+
+import "testing"
+
+func TestTextConverter_ToHTML_Links(t *testing.T) {
+	c := NewTextConverter(nil, nil)
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"<https://example.com/>", "<a href='https://example.com/'>https://example.com/</a>"},
+		{"<https://example.com/|Example>", "<a href='https://example.com/'>Example</a>"},
+		{"<https://example.com/?a=1&b=2|A and B>", "<a href='https://example.com/?a=1&amp;b=2'>A and B</a>"},
+		{"see <https://example.com/a|a> and <https://example.com/b|b>", "see <a href='https://example.com/a'>a</a> and <a href='https://example.com/b'>b</a>"},
+	} {
+		if got := c.ToHTML(tc.in); got != tc.want {
+			t.Errorf("ToHTML(%q)\n got: %s\nwant: %s", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,741 @@
+package slacklog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	// pure-Go SQLite driver. registered as "sqlite".
+	_ "modernc.org/sqlite"
+)
+
+// dbSchema : BuildDB()が作成するSQLiteデータベースのスキーマ。
+// 各テーブルのjsonカラムはエクスポートされたJSONをそのまま保持しており、Goの構
+// 造体を復元する際に用いる。それ以外のカラムは検索や集計のためのものである。
+// threadsはmessagesから集計したスレッドの一覧で、Threadと同じく先頭メッセージ
+// がない場合はroot_tsが空となり、root_year/root_monthは最初の返信の月となる。
+// reply_usersは返信したユーザのIDを最初に返信した順に並べたJSONの配列である。
+const dbSchema = `
+CREATE TABLE users (
+	id           TEXT PRIMARY KEY,
+	name         TEXT NOT NULL,
+	real_name    TEXT NOT NULL,
+	display_name TEXT NOT NULL,
+	bot_id       TEXT NOT NULL,
+	is_bot       INTEGER NOT NULL,
+	deleted      INTEGER NOT NULL,
+	json         TEXT NOT NULL
+);
+CREATE INDEX users_bot_id ON users (bot_id);
+
+CREATE TABLE channels (
+	id          TEXT PRIMARY KEY,
+	name        TEXT NOT NULL,
+	created     INTEGER NOT NULL,
+	is_archived INTEGER NOT NULL,
+	json        TEXT NOT NULL
+);
+CREATE INDEX channels_name ON channels (name);
+
+CREATE TABLE emojis (
+	name  TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE messages (
+	channel_id       TEXT NOT NULL,
+	ts               TEXT NOT NULL,
+	thread_ts        TEXT NOT NULL,
+	user             TEXT NOT NULL,
+	subtype          TEXT NOT NULL,
+	text             TEXT NOT NULL,
+	year             INTEGER NOT NULL,
+	month            INTEGER NOT NULL,
+	visible          INTEGER NOT NULL,
+	shown_in_channel INTEGER NOT NULL,
+	json             TEXT NOT NULL,
+	PRIMARY KEY (channel_id, ts)
+);
+CREATE INDEX messages_month ON messages (channel_id, year, month, ts);
+CREATE INDEX messages_thread ON messages (channel_id, thread_ts, ts);
+CREATE INDEX messages_user ON messages (user);
+
+CREATE TABLE reactions (
+	channel_id TEXT NOT NULL,
+	ts         TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	user       TEXT NOT NULL
+);
+CREATE INDEX reactions_message ON reactions (channel_id, ts);
+CREATE INDEX reactions_name ON reactions (name);
+
+CREATE TABLE files (
+	id          TEXT NOT NULL,
+	channel_id  TEXT NOT NULL,
+	ts          TEXT NOT NULL,
+	user        TEXT NOT NULL,
+	name        TEXT NOT NULL,
+	title       TEXT NOT NULL,
+	mimetype    TEXT NOT NULL,
+	filetype    TEXT NOT NULL,
+	size        INTEGER NOT NULL,
+	mode        TEXT NOT NULL,
+	is_external INTEGER NOT NULL,
+	json        TEXT NOT NULL,
+	PRIMARY KEY (channel_id, ts, id)
+);
+CREATE INDEX files_id ON files (id);
+CREATE INDEX files_filetype ON files (filetype);
+
+CREATE TABLE threads (
+	channel_id   TEXT NOT NULL,
+	thread_ts    TEXT NOT NULL,
+	root_ts      TEXT NOT NULL,
+	root_year    INTEGER NOT NULL,
+	root_month   INTEGER NOT NULL,
+	reply_count  INTEGER NOT NULL,
+	reply_users  TEXT NOT NULL,
+	latest_reply TEXT NOT NULL,
+	PRIMARY KEY (channel_id, thread_ts)
+);
+CREATE INDEX threads_root_month ON threads (channel_id, root_year, root_month);
+
+`
+
+// BuildDB : dataDirに置かれたログデータを読み込み、dbPathにSQLiteデータベース
+// として書き出す。
+// dbPathにファイルが既に存在する場合は作り直す。
+// チャンネルはcfg.Channelsに指定したもののみを読み込む。
+func BuildDB(dbPath, dataDir string, cfg *Config) error {
+	if err := os.Remove(dbPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(dbSchema); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	ut, err := NewUserTable(filepath.Join(dataDir, "users.json"))
+	if err != nil {
+		return err
+	}
+	if err := insertUsers(db, ut.Users); err != nil {
+		return err
+	}
+
+	ct, err := NewChannelTable(filepath.Join(dataDir, "channels.json"), cfg.Channels)
+	if err != nil {
+		return err
+	}
+	if err := insertChannels(db, ct.Channels); err != nil {
+		return err
+	}
+
+	et, err := NewEmojiTable(filepath.Join(dataDir, cfg.EmojiJSONPath))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		// EmojiTable is not required, so if the file just doesn't exist, continue
+		// processing.
+	} else if err := insertEmojis(db, et.URLMap); err != nil {
+		return err
+	}
+
+	for _, ch := range ct.Channels {
+		if err := insertChannelMessages(db, ch.ID, filepath.Join(dataDir, ch.ID)); err != nil {
+			return fmt.Errorf("failed to load channel %s: %w", ch.ID, err)
+		}
+		if err := insertThreads(db, ch.ID); err != nil {
+			return fmt.Errorf("failed to build threads of channel %s: %w", ch.ID, err)
+		}
+	}
+
+	_, err = db.Exec("ANALYZE")
+	return err
+}
+
+// withTx : fnをトランザクション内で実行する。fnがエラーを返した場合はロール
+// バックする。
+func withTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertUsers(db *sql.DB, users []User) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`INSERT INTO users
+(id, name, real_name, display_name, bot_id, is_bot, deleted, json)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, u := range users {
+			b, err := json.Marshal(u)
+			if err != nil {
+				return err
+			}
+			_, err = stmt.Exec(u.ID, u.Name, u.Profile.RealName,
+				u.Profile.DisplayName, u.Profile.BotID, u.IsBot, u.Deleted,
+				string(b))
+			if err != nil {
+				return fmt.Errorf("failed to insert user %s: %w", u.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+func insertChannels(db *sql.DB, channels []Channel) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`INSERT INTO channels
+(id, name, created, is_archived, json) VALUES (?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, ch := range channels {
+			b, err := json.Marshal(ch)
+			if err != nil {
+				return err
+			}
+			_, err = stmt.Exec(ch.ID, ch.Name, ch.Created, ch.IsArchived, string(b))
+			if err != nil {
+				return fmt.Errorf("failed to insert channel %s: %w", ch.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+func insertEmojis(db *sql.DB, emojis map[string]string) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`INSERT INTO emojis (name, value) VALUES (?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for name, value := range emojis {
+			if _, err := stmt.Exec(name, value); err != nil {
+				return fmt.Errorf("failed to insert emoji %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// insertChannelMessages : dirに置かれたチャンネルのメッセージファイルを全て読み
+// 込み、messages/reactions/filesテーブルに登録する。
+// 月の判定にはMessageTableと同じくファイル名の年月を用いる。
+func insertChannelMessages(db *sql.DB, channelID, dir string) error {
+	names, err := readDirNames(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return withTx(db, func(tx *sql.Tx) error {
+		msgStmt, err := tx.Prepare(`INSERT OR REPLACE INTO messages
+(channel_id, ts, thread_ts, user, subtype, text, year, month, visible, shown_in_channel, json)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer msgStmt.Close()
+		reactStmt, err := tx.Prepare(`INSERT INTO reactions
+(channel_id, ts, name, user) VALUES (?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer reactStmt.Close()
+		fileStmt, err := tx.Prepare(`INSERT OR REPLACE INTO files
+(id, channel_id, ts, user, name, title, mimetype, filetype, size, mode, is_external, json)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer fileStmt.Close()
+
+		for _, name := range names {
+			match := reMsgFilename.FindStringSubmatch(name)
+			if len(match) == 0 {
+				slog.Warn("skipping a file not named YYYY-MM-DD.json", "path", filepath.Join(dir, name))
+				continue
+			}
+			key, err := NewMessageMonthKey(match[1], match[2])
+			if err != nil {
+				return err
+			}
+			var msgs []Message
+			if err := ReadFileAsJSON(filepath.Join(dir, name), &msgs); err != nil {
+				return fmt.Errorf("failed to unmarshal %s: %w", name, err)
+			}
+			for _, msg := range msgs {
+				b, err := json.Marshal(msg)
+				if err != nil {
+					return err
+				}
+				_, err = msgStmt.Exec(channelID, msg.Ts, msg.ThreadTs, msg.User,
+					msg.Subtype, msg.Text, key.year, key.month, msg.IsVisible(),
+					msg.IsShownInChannel(), string(b))
+				if err != nil {
+					return fmt.Errorf("failed to insert message %s: %w", msg.Ts, err)
+				}
+				for _, r := range msg.Reactions {
+					for _, u := range r.Users {
+						if _, err := reactStmt.Exec(channelID, msg.Ts, r.Name, u); err != nil {
+							return err
+						}
+					}
+				}
+				for _, f := range msg.Files {
+					b, err := json.Marshal(f)
+					if err != nil {
+						return err
+					}
+					_, err = fileStmt.Exec(f.ID, channelID, msg.Ts, f.User, f.Name,
+						f.Title, f.Mimetype, f.Filetype, f.Size, f.Mode, f.IsExternal,
+						string(b))
+					if err != nil {
+						return fmt.Errorf("failed to insert file %s: %w", f.ID, err)
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// insertThreads : messagesテーブルに登録したチャンネルのメッセージからスレッド
+// を集計し、threadsテーブルに登録する。
+func insertThreads(db *sql.DB, channelID string) error {
+	rows, err := db.Query(`SELECT thread_ts, ts, user, year, month FROM messages
+WHERE channel_id = ? AND visible = 1 AND thread_ts != ''
+ORDER BY thread_ts, ts`, channelID)
+	if err != nil {
+		return err
+	}
+	var threads []*Thread
+	for rows.Next() {
+		var (
+			key MessageMonthKey
+			msg Message
+		)
+		if err := rows.Scan(&msg.ThreadTs, &msg.Ts, &msg.User, &key.year, &key.month); err != nil {
+			rows.Close()
+			return err
+		}
+		if n := len(threads); n == 0 || threads[n-1].ts != msg.ThreadTs {
+			threads = append(threads, newThread(msg.ThreadTs))
+		}
+		threads[len(threads)-1].add(key, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return withTx(db, func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`INSERT INTO threads
+(channel_id, thread_ts, root_ts, root_year, root_month, reply_count, reply_users, latest_reply)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, t := range threads {
+			rootTs := ""
+			if t.HasRoot() {
+				rootTs = t.Ts()
+			}
+			users := t.ReplyUsers()
+			if users == nil {
+				users = []string{}
+			}
+			b, err := json.Marshal(users)
+			if err != nil {
+				return err
+			}
+			key := t.RootMonth()
+			_, err = stmt.Exec(channelID, t.Ts(), rootTs, key.year, key.month,
+				t.ReplyCount(), string(b), t.LatestReply())
+			if err != nil {
+				return fmt.Errorf("failed to insert thread %s: %w", t.Ts(), err)
+			}
+		}
+		return nil
+	})
+}
+
+func readDirNames(path string) ([]string, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(0)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DBLogStore : BuildDB()で作成したSQLiteデータベースからログデータを取得するた
+// めの構造体。
+// メッセージは必要になった時点でSQLで取得するため、FileLogStoreと違いログ全体
+// をメモリに保持しない。
+type DBLogStore struct {
+	db       *sql.DB
+	channels []Channel
+}
+
+// NewDBLogStore : dbPathに指定したSQLiteデータベースを開き、DBLogStoreを生成す
+// る。
+// cfg.Channelsに指定したチャンネルのみを扱う。
+func NewDBLogStore(dbPath string, cfg *Config) (*DBLogStore, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT json FROM channels ORDER BY name`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	var channels []Channel
+	err = scanJSONRows(rows, func(b []byte) error {
+		var ch Channel
+		if err := json.Unmarshal(b, &ch); err != nil {
+			return err
+		}
+		channels = append(channels, ch)
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DBLogStore{
+		db:       db,
+		channels: FilterChannel(channels, cfg.Channels),
+	}, nil
+}
+
+// DB : 任意のクエリを実行するために、内部で保持している*sql.DBを返す。
+func (s *DBLogStore) DB() *sql.DB {
+	return s.db
+}
+
+// Close : データベースを閉じる。
+func (s *DBLogStore) Close() error {
+	return s.db.Close()
+}
+
+// scanJSONRows : 1カラムのみを返すrowsを走査し、各行の値をfnに渡す。
+// rowsは必ず閉じられる。
+func scanJSONRows(rows *sql.Rows, fn func(b []byte) error) error {
+	defer rows.Close()
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *DBLogStore) GetChannels() []Channel {
+	return s.channels
+}
+
+func (s *DBLogStore) hasMonth(channelID string, key MessageMonthKey) bool {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM (SELECT 1 FROM messages
+WHERE channel_id = ? AND year = ? AND month = ? AND visible = 1 AND shown_in_channel = 1
+LIMIT 1)`, channelID, key.year, key.month).Scan(&n)
+	return err == nil && n > 0
+}
+
+func (s *DBLogStore) HasNextMonth(channelID string, key MessageMonthKey) bool {
+	return s.hasMonth(channelID, key.Next())
+}
+
+func (s *DBLogStore) HasPrevMonth(channelID string, key MessageMonthKey) bool {
+	return s.hasMonth(channelID, key.Prev())
+}
+
+func (s *DBLogStore) GetMonthKeys(channelID string) ([]MessageMonthKey, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT year, month FROM messages
+WHERE channel_id = ? AND visible = 1 AND shown_in_channel = 1
+ORDER BY year, month`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []MessageMonthKey
+	for rows.Next() {
+		var key MessageMonthKey
+		if err := rows.Scan(&key.year, &key.month); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *DBLogStore) GetMessagesOfMonth(channelID string, key MessageMonthKey) ([]Message, error) {
+	rows, err := s.db.Query(`SELECT json FROM messages
+WHERE channel_id = ? AND year = ? AND month = ? AND visible = 1 AND shown_in_channel = 1
+ORDER BY ts`, channelID, key.year, key.month)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []Message
+	err = scanJSONRows(rows, func(b []byte) error {
+		var msg Message
+		if err := json.Unmarshal(b, &msg); err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	markTrail(msgs)
+	return msgs, nil
+}
+
+// ReleaseMonth : DBLogStoreはメッセージを保持しないため何もしない。
+func (s *DBLogStore) ReleaseMonth(channelID string, key MessageMonthKey) {
+}
+
+func (s *DBLogStore) GetMessagesPerMonth(channelID string) (map[MessageMonthKey][]Message, error) {
+	rows, err := s.db.Query(`SELECT year, month, json FROM messages
+WHERE channel_id = ? AND visible = 1 AND shown_in_channel = 1
+ORDER BY year, month, ts`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	msgsMap := map[MessageMonthKey][]Message{}
+	for rows.Next() {
+		var (
+			key MessageMonthKey
+			b   []byte
+		)
+		if err := rows.Scan(&key.year, &key.month, &b); err != nil {
+			return nil, err
+		}
+		var msg Message
+		if err := json.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		msgsMap[key] = append(msgsMap[key], msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, msgs := range msgsMap {
+		markTrail(msgs)
+	}
+	return msgsMap, nil
+}
+
+// queryUserByID : ユーザIDまたはボットIDがidのユーザを一件取得するクエリ。
+// UserTableと同じく、ユーザIDの一致をボットIDの一致より優先し、同じボットIDの
+// ユーザが複数いる場合は後に登録したものを返す。
+const queryUserByID = `WHERE id = ?1 OR (bot_id = ?1 AND bot_id != '')
+ORDER BY id = ?1 DESC, rowid DESC LIMIT 1`
+
+func (s *DBLogStore) GetUserByID(userID string) (*User, bool) {
+	var b []byte
+	err := s.db.QueryRow(`SELECT json FROM users `+queryUserByID, userID).Scan(&b)
+	if err != nil {
+		return nil, false
+	}
+	var u User
+	if err := json.Unmarshal(b, &u); err != nil {
+		return nil, false
+	}
+	return &u, true
+}
+
+func (s *DBLogStore) GetDisplayNameByUserID(userID string) string {
+	var realName, displayName string
+	err := s.db.QueryRow(`SELECT real_name, display_name FROM users `+queryUserByID,
+		userID).Scan(&realName, &displayName)
+	if err != nil {
+		return ""
+	}
+	if realName != "" {
+		return realName
+	}
+	return displayName
+}
+
+func (s *DBLogStore) GetDisplayNameMap() map[string]string {
+	ret := map[string]string{}
+	rows, err := s.db.Query(`SELECT id, bot_id, real_name, display_name FROM users
+ORDER BY rowid`)
+	if err != nil {
+		return ret
+	}
+	defer rows.Close()
+	// user IDs take precedence over bot IDs, as in UserTable.
+	byBotID := map[string]string{}
+	for rows.Next() {
+		var id, botID, realName, displayName string
+		if err := rows.Scan(&id, &botID, &realName, &displayName); err != nil {
+			return ret
+		}
+		name := realName
+		if name == "" {
+			name = displayName
+		}
+		ret[id] = name
+		if botID != "" {
+			byBotID[botID] = name
+		}
+	}
+	for botID, name := range byBotID {
+		if _, ok := ret[botID]; !ok {
+			ret[botID] = name
+		}
+	}
+	return ret
+}
+
+func (s *DBLogStore) GetEmojiMap() map[string]string {
+	ret := map[string]string{}
+	rows, err := s.db.Query(`SELECT name, value FROM emojis`)
+	if err != nil {
+		return ret
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return ret
+		}
+		ret[name] = value
+	}
+	return ret
+}
+
+func (s *DBLogStore) GetThread(channelID, ts string) (*Thread, bool) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM threads WHERE channel_id = ? AND thread_ts = ?`,
+		channelID, ts).Scan(&n)
+	if err != nil || n == 0 {
+		return nil, false
+	}
+	rows, err := s.db.Query(`SELECT year, month, json FROM messages
+WHERE channel_id = ? AND thread_ts = ? AND visible = 1
+ORDER BY ts`, channelID, ts)
+	if err != nil {
+		return nil, false
+	}
+	defer rows.Close()
+	t := newThread(ts)
+	found := false
+	for rows.Next() {
+		var (
+			key MessageMonthKey
+			b   []byte
+		)
+		if err := rows.Scan(&key.year, &key.month, &b); err != nil {
+			return nil, false
+		}
+		var msg Message
+		if err := json.Unmarshal(b, &msg); err != nil {
+			return nil, false
+		}
+		found = true
+		t.add(key, msg)
+	}
+	if rows.Err() != nil || !found {
+		return nil, false
+	}
+	return t, true
+}
+
+func (s *DBLogStore) GetMessageMonths(channelID string) (map[string]MessageMonthKey, error) {
+	rows, err := s.db.Query(`SELECT m.ts,
+CASE WHEN m.shown_in_channel = 1 THEN m.year ELSE p.year END,
+CASE WHEN m.shown_in_channel = 1 THEN m.month ELSE p.month END
+FROM messages m
+LEFT JOIN messages p ON p.channel_id = m.channel_id AND p.ts = m.thread_ts AND p.visible = 1
+WHERE m.channel_id = ? AND m.visible = 1 AND (m.shown_in_channel = 1 OR p.ts IS NOT NULL)`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	months := map[string]MessageMonthKey{}
+	for rows.Next() {
+		var (
+			ts  string
+			key MessageMonthKey
+		)
+		if err := rows.Scan(&ts, &key.year, &key.month); err != nil {
+			return nil, err
+		}
+		months[ts] = key
+	}
+	return months, rows.Err()
+}
+
+func (s *DBLogStore) GetContinuedThreads(channelID string, key MessageMonthKey) []*Thread {
+	rows, err := s.db.Query(`SELECT t.thread_ts FROM threads t
+WHERE t.channel_id = ?1 AND t.root_ts != '' AND t.reply_count > 0
+AND (t.root_year < ?2 OR t.root_year = ?2 AND t.root_month < ?3)
+AND EXISTS (SELECT 1 FROM messages r
+	WHERE r.channel_id = t.channel_id AND r.thread_ts = t.thread_ts
+	AND r.ts != r.thread_ts AND r.visible = 1 AND r.year = ?2 AND r.month = ?3)
+ORDER BY t.thread_ts`, channelID, key.year, key.month)
+	if err != nil {
+		return nil
+	}
+	var tss []string
+	for rows.Next() {
+		var ts string
+		if err := rows.Scan(&ts); err != nil {
+			rows.Close()
+			return nil
+		}
+		tss = append(tss, ts)
+	}
+	rows.Close()
+	var threads []*Thread
+	for _, ts := range tss {
+		if t, ok := s.GetThread(channelID, ts); ok {
+			threads = append(threads, t)
+		}
+	}
+	return threads
+}
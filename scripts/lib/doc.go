@@ -2,11 +2,13 @@
 slacklogパッケージはSlackからエクスポートされた各チャンネルのログの取得、HTMLへ
 の変換を行なうためのパッケージである。
 
-LogStoreはログデータの取得方法を規定し、必要に応じて各種ログテーブルからデータ
-を取得する。
+LogStoreはログデータの取得方法を規定するインターフェースである。
+FileLogStoreはエクスポートしたJSONのディレクトリから、必要に応じて各種ログテー
+ブルを介してデータを取得する。DBLogStoreはBuildDBで作成したSQLiteデータベース
+から、MemoryLogStoreはメモリ上に登録したデータからそれぞれデータを取得する。
 
 ChannelTable/MessageTable/UserTable/EmojiTableはSlackからエクスポートされたJSON
-形式のログファイルを読み込み、LogStoreが処理しやすい形でデータを保持する。
+形式のログファイルを読み込み、FileLogStoreが処理しやすい形でデータを保持する。
 
 TextConverterはログが保持しているテキストのエスケープやHTMLへの変換を行なう。
 
@@ -0,0 +1,310 @@
+package slacklog
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	htmlp "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// documentFilename : download-filesがポストやキャンバスの内容を書き出すファイル
+// の名前
+const documentFilename = "document.html"
+
+var reDocumentBody = regexp.MustCompile(`(?is)<body\b[^>]*>(.*)</body\s*>`)
+
+// documentElements : 文書のHTMLに残す要素。これ以外の要素はタグを取り除き、中
+// のテキストのみを残す。
+var documentElements = map[atom.Atom]bool{
+	atom.A: true, atom.B: true, atom.Blockquote: true, atom.Br: true,
+	atom.Code: true, atom.Del: true, atom.Div: true, atom.Em: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true,
+	atom.H6: true, atom.Hr: true, atom.I: true, atom.Img: true, atom.Li: true,
+	atom.Ol: true, atom.P: true, atom.Pre: true, atom.S: true, atom.Span: true,
+	atom.Strike: true, atom.Strong: true, atom.Sub: true, atom.Sup: true,
+	atom.Table: true, atom.Tbody: true, atom.Td: true, atom.Th: true,
+	atom.Thead: true, atom.Tr: true, atom.U: true, atom.Ul: true,
+}
+
+// documentVoidElements : 終了タグのない要素
+var documentVoidElements = map[atom.Atom]bool{
+	atom.Br: true, atom.Hr: true, atom.Img: true,
+}
+
+// documentDroppedElements : 中身ごと取り除く要素
+var documentDroppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true,
+	atom.Embed: true, atom.Template: true, atom.Noscript: true, atom.Svg: true,
+	atom.Math: true, atom.Textarea: true, atom.Select: true, atom.Title: true,
+	atom.Head: true,
+}
+
+// documentAttrs : 要素毎に残す属性。キーが0のものは全ての要素に共通の属性。
+var documentAttrs = map[atom.Atom]map[string]bool{
+	0:        {"class": true, "title": true},
+	atom.A:   {"href": true},
+	atom.Img: {"src": true, "alt": true, "width": true, "height": true},
+	atom.Ol:  {"start": true},
+	atom.Td:  {"colspan": true, "rowspan": true},
+	atom.Th:  {"colspan": true, "rowspan": true},
+}
+
+// documentURLAttrs : URLとして値を検証する属性
+var documentURLAttrs = map[string]bool{"href": true, "src": true}
+
+// IsDocument : ポストやキャンバスなど、Slack上で編集する文書であるかを判定す
+// る。
+func (f *MessageFile) IsDocument() bool {
+	switch f.Mode {
+	case "post", "space", "canvas":
+		return true
+	}
+	switch f.Filetype {
+	case "post", "space", "quip", "canvas":
+		return true
+	}
+	return false
+}
+
+// DocumentFilePath : download-filesがfilesDirに書き出した文書の内容のパスを返
+// す。
+func (f *MessageFile) DocumentFilePath(filesDir string) string {
+	return filepath.Join(filesDir, f.ID, documentFilename)
+}
+
+// ExternalURL : Google Driveなど外部のサービスのファイルのURLを返す。
+func (f *MessageFile) ExternalURL() string {
+	if f.EditLink != "" {
+		return f.EditLink
+	}
+	return f.URLPrivate
+}
+
+// documentPageURL : 文書のページのURLを返す。
+func documentPageURL(f *MessageFile) string {
+	return fmt.Sprintf("{{ site.baseurl }}/documents/%s/", f.ID)
+}
+
+// sanitizeDocument : 文書のHTMLからbodyの中身を取り出し、documentElementsと
+// documentAttrsに挙げた安全な要素と属性のみを残す。
+// 閉じられていない要素は最後に閉じ、開いていない要素の終了タグは取り除くため、
+// ページの他の部分の構造を壊さない。
+func sanitizeDocument(s string) string {
+	if m := reDocumentBody.FindStringSubmatch(s); m != nil {
+		s = m[1]
+	}
+	var b strings.Builder
+	var open []atom.Atom
+	// the element dropped with its content, and its nesting depth
+	var dropped atom.Atom
+	depth := 0
+	z := htmlp.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == htmlp.ErrorToken {
+			break
+		}
+		tok := z.Token()
+		if depth > 0 {
+			switch {
+			case tt == htmlp.StartTagToken && tok.DataAtom == dropped:
+				depth++
+			case tt == htmlp.EndTagToken && tok.DataAtom == dropped:
+				depth--
+			}
+			continue
+		}
+		switch tt {
+		case htmlp.TextToken:
+			b.WriteString(html.EscapeString(tok.Data))
+		case htmlp.StartTagToken, htmlp.SelfClosingTagToken:
+			if documentDroppedElements[tok.DataAtom] {
+				if tt == htmlp.StartTagToken {
+					dropped, depth = tok.DataAtom, 1
+				}
+				continue
+			}
+			if !documentElements[tok.DataAtom] {
+				continue
+			}
+			writeDocumentTag(&b, tok)
+			if !documentVoidElements[tok.DataAtom] {
+				if tt == htmlp.SelfClosingTagToken {
+					b.WriteString("</" + tok.Data + ">")
+				} else {
+					open = append(open, tok.DataAtom)
+				}
+			}
+		case htmlp.EndTagToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != tok.DataAtom {
+					continue
+				}
+				for len(open) > i {
+					b.WriteString("</" + open[len(open)-1].String() + ">")
+					open = open[:len(open)-1]
+				}
+				break
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i].String() + ">")
+	}
+	out := strings.Replace(strings.TrimSpace(b.String()), "{{", "&#123;&#123;", -1)
+	return strings.Replace(out, "{%", "&#123;&#37;", -1)
+}
+
+// writeDocumentTag : 開始タグtokを、documentAttrsに挙げた属性のみを付けてbに
+// 書き出す。
+func writeDocumentTag(b *strings.Builder, tok htmlp.Token) {
+	b.WriteString("<" + tok.Data)
+	for _, attr := range tok.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || !documentAttrs[0][key] && !documentAttrs[tok.DataAtom][key] {
+			continue
+		}
+		if documentURLAttrs[key] && !isSafeDocumentURL(attr.Val) {
+			continue
+		}
+		b.WriteString(" " + key + "='" + html.EscapeString(attr.Val) + "'")
+	}
+	b.WriteString(">")
+}
+
+// isSafeDocumentURL : 文字参照を復号した後の属性の値uが、スキームのない相対URL
+// か、http、https、mailtoのURLであるかを判定する。
+// ブラウザはURL中のタブや改行、先頭の制御文字や空白を無視するため、それらを除
+// いてスキームを判定する。
+func isSafeDocumentURL(u string) bool {
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' {
+		return true
+	}
+	switch strings.ToLower(u[:i]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// readDocument : 文書の内容をページに埋め込むHTMLとして返す。
+// download-filesが書き出した内容、エクスポートに含まれるsimplified_html、プレ
+// ビューのテキストの順に用いる。いずれもなければfalseを返す。
+func (g *HTMLGenerator) readDocument(f *MessageFile) (string, bool) {
+	if !f.IsDocument() || f.IsExternal {
+		return "", false
+	}
+	if g.cfg.FilesDir != "" {
+		if b, err := os.ReadFile(f.DocumentFilePath(g.cfg.FilesDir)); err == nil {
+			return sanitizeDocument(string(b)), true
+		}
+	}
+	if f.SimplifiedHTML != "" {
+		return sanitizeDocument(f.SimplifiedHTML), true
+	}
+	if f.Preview != "" {
+		s := html.EscapeString(strings.TrimSpace(f.Preview))
+		s = strings.Replace(s, "{{", "&#123;&#123;", -1)
+		s = strings.Replace(s, "{%", "&#123;&#37;", -1)
+		return "<div class='slacklog-document-text'>" + s + "</div>", true
+	}
+	return "", false
+}
+
+// documentURL : 文書のページのURLを返す。ページを生成しない場合は空文字列を返
+// す。
+func (g *HTMLGenerator) documentURL(f *MessageFile) string {
+	if _, ok := g.readDocument(f); !ok {
+		return ""
+	}
+	return documentPageURL(f)
+}
+
+// documentEntry : 文書のファイルと、それを投稿したメッセージ。
+type documentEntry struct {
+	File    MessageFile
+	Channel Channel
+	// メッセージを表示した月。スレッドへの返信であれば先頭のメッセージの月。
+	Key MessageMonthKey
+	Msg *Message
+}
+
+// documentIndex : 生成した月のページに含まれる文書を集める。
+type documentIndex struct {
+	mu sync.Mutex
+	// key: file ID
+	files map[string]*documentEntry
+}
+
+func newDocumentIndex() *documentIndex {
+	return &documentIndex{files: map[string]*documentEntry{}}
+}
+
+func (d *documentIndex) add(channel Channel, key MessageMonthKey, msg Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, f := range msg.Files {
+		if !f.IsDocument() || f.IsExternal {
+			continue
+		}
+		// the first post of the document wins.
+		if e, ok := d.files[f.ID]; ok && e.Msg.Ts <= msg.Ts {
+			continue
+		}
+		m := msg
+		d.files[f.ID] = &documentEntry{File: f, Channel: channel, Key: key, Msg: &m}
+	}
+}
+
+func (d *documentIndex) sorted() []*documentEntry {
+	entries := make([]*documentEntry, 0, len(d.files))
+	for _, e := range d.files {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].File.ID < entries[j].File.ID
+	})
+	return entries
+}
+
+// generateDocuments : 集めた文書毎のページをpath/{file-id}/index.htmlに生成す
+// る。
+func (g *HTMLGenerator) generateDocuments(path string) error {
+	entries := g.documents.sorted()
+	if len(entries) == 0 {
+		return nil
+	}
+	for _, e := range entries {
+		content, ok := g.readDocument(&e.File)
+		if !ok {
+			continue
+		}
+		dir := filepath.Join(path, e.File.ID)
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return fmt.Errorf("could not create %s directory: %w", dir, err)
+		}
+		params := map[string]interface{}{
+			"entry":   e,
+			"file":    &e.File,
+			"content": content,
+		}
+		if err := g.executeAndWrite("document.tmpl", params, filepath.Join(dir, "index.html")); err != nil {
+			return fmt.Errorf("failed to generate document %s: %w", e.File.ID, err)
+		}
+	}
+	return nil
+}
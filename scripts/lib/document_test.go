@@ -0,0 +1,39 @@
+package slacklog
+
+import "testing"
+
+func TestSanitizeDocument(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", `<p>hello <b>world</b></p>`, `<p>hello <b>world</b></p>`},
+		{"body", `<html><head><title>t</title></head><body><p>x</p></body></html>`, `<p>x</p>`},
+		{"script", `<p>a<script>alert(1)</script>b</p>`, `<p>ab</p>`},
+		{"nested dropped", `<svg><svg></svg><a href=x>y</a></svg>z`, `z`},
+		{"slash attr", `<img/onerror=alert(1) src=x>`, `<img src='x'>`},
+		{"entity scheme", `<a href="&#106;avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"tab scheme", `<a href="java&#x09;script:alert(1)">x</a>`, `<a>x</a>`},
+		{"leading space scheme", `<a href=" &#1;javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"upper scheme", `<a href="JAVASCRIPT:alert(1)">x</a>`, `<a>x</a>`},
+		{"data url", `<img src="data:image/svg+xml,<svg onload=alert(1)>">`, `<img>`},
+		{"safe urls", `<a href="https://example.com/?a=1&amp;b=2">x</a><a href="/p:q">y</a>`, `<a href='https://example.com/?a=1&amp;b=2'>x</a><a href='/p:q'>y</a>`},
+		{"svg handler", `<svg onload=alert(1)><circle/></svg>ok`, `ok`},
+		{"math handler", `<math><mi xlink:href="javascript:alert(1)">x</mi></math>ok`, `ok`},
+		{"formaction", `<form><button formaction="javascript:alert(1)">x</button></form>`, `x`},
+		{"event attr", `<p onclick="alert(1)" class="c">x</p>`, `<p class='c'>x</p>`},
+		{"unclosed", `<div><p>x`, `<div><p>x</p></div>`},
+		{"stray end tag", `x</div></body>y`, `xy`},
+		{"text escaped", `a &lt;script&gt; b`, `a &lt;script&gt; b`},
+		{"attr quote", `<a title="x' onclick='alert(1)">y</a>`, `<a title='x&#39; onclick=&#39;alert(1)'>y</a>`},
+		{"liquid", `<p>{{ site }} {% raw %}</p>`, `<p>&#123;&#123; site }} &#123;&#37; raw %}</p>`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := sanitizeDocument(tc.in)
+			if got != tc.want {
+				t.Errorf("sanitizeDocument(%q)\n got: %s\nwant: %s", tc.in, got, tc.want)
+			}
+		})
+	}
+}
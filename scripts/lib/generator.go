@@ -1,174 +1,457 @@
 package slacklog
 
 import (
+	"context"
 	"fmt"
 	"html"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"sort"
-	"strings"
-	"sync"
+	"regexp"
+	"runtime"
+	"strconv"
 	"text/template"
+	"time"
 )
 
 // HTMLGenerator : ログデータからHTMLを生成するための構造体。
 type HTMLGenerator struct {
-	// text/template形式のテンプレートが置いてあるディレクトリ
+	// 組み込みのテンプレートより優先するtext/template形式のテンプレートが置い
+	// てあるディレクトリ。空なら組み込みのテンプレートのみを用いる。
 	templateDir string
+	// 全てのページのテンプレートと部品のセット。generatePages()毎に読み込む。
+	templates *template.Template
 	// ログデータを取得するためのLogStore
-	s *LogStore
+	s LogStore
 	// markdown形式のテキストを変換するためのTextConverter
 	c   *TextConverter
 	cfg Config
+	// ページを並列に生成するワーカーの数
+	workers int
+	// ユーザページのための投稿の集計。Generate()毎に作り直す。
+	activity *activityCollector
+	// カレンダーとタイムラインのための日毎の投稿数。Generate()毎に作り直す。
+	dates *dateIndex
+	// 文書のページのための、月のページに含まれるポストやキャンバス。Generate()
+	// 毎に作り直す。
+	documents *documentIndex
+	// 前の月の最後のページへリンクするための、チャンネルの月毎のページ数。
+	// Generate()毎にcountPages()で数える。
+	pageCounts map[string]map[MessageMonthKey]int
+	// 全てのテンプレートに"site"として渡すサイトの情報
+	site *SiteParams
+	// テンプレートのUI文字列
+	catalog Catalog
+	// Config.ExtraLocalesのページを生成する場合はその言語。サイト内のリンクを
+	// ${localePrefix}/以下に書き換える。
+	localePrefix string
 }
 
 // NewHTMLGenerator : HTMLGeneratorを生成する。
-func NewHTMLGenerator(templateDir string, s *LogStore) *HTMLGenerator {
+// cfg.Workersが0以下の場合はCPU数だけワーカーを起動する。
+func NewHTMLGenerator(templateDir string, s LogStore, cfg *Config) *HTMLGenerator {
 	users := s.GetDisplayNameMap()
 	emojis := s.GetEmojiMap()
 	c := NewTextConverter(users, emojis)
 
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
 	return &HTMLGenerator{
 		templateDir: templateDir,
 		s:           s,
 		c:           c,
+		cfg:         *cfg,
+		workers:     workers,
+		site:        newSiteParams(cfg, cfg.Locale),
+		catalog:     catalogOf(cfg.Locale),
+	}
+}
+
+// PageError : 生成に失敗したページのチャンネルと月を保持するエラー。
+type PageError struct {
+	ChannelID string
+	// チャンネルのindex.htmlなど、月毎のページでない場合はnil
+	Month *MessageMonthKey
+	Err   error
+}
+
+func (e *PageError) Error() string {
+	if e.Month == nil {
+		return fmt.Sprintf("channel %s: %s", e.ChannelID, e.Err)
 	}
+	return fmt.Sprintf("channel %s %s/%s: %s", e.ChannelID, e.Month.Year(), e.Month.Month(), e.Err)
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Err
+}
+
+// generateTask : Generate()でワーカーが処理する生成単位。
+// チャンネルのkeyの月のページ(日毎のページを含む)を生成する。
+type generateTask struct {
+	channel Channel
+	key     MessageMonthKey
 }
 
 // Generate はoutDirにログデータの変換結果を生成する。
 // 目標とする構造は以下となる:
 //   - outDir/
 //     - index.html // generateIndex()
-//     - ${channel_id}/ // generateChannelDir()
+//     - ${channel_id}/
 //       - index.html // generateChannelIndex()
 //       - ${YYYY}/
 //         - ${MM}/
 //           - index.html // generateMessageDir()
-func (g *HTMLGenerator) Generate(outDir string) error {
+//           - page/${N}/
+//             - index.html // generateMessageDir() (Config.MessagesPerPage)
+//           - ts.json // writeTsMap() (Config.MessagesPerPage)
+//           - ${DD}/
+//             - index.html // generateDayPages() (Config.DayPages)
+//     - timeline/ // generateTimeline() (Config.TimelinePages)
+//     - documents/${file_id}/
+//       - index.html // generateDocuments()
+//     - users/ // generateUserPages()
+//     - permalink/
+//       - index.html, months.json // generatePermalinkPage()
+//     - ${locale}/ // Config.ExtraLocales
+//       - index.html, ${channel_id}/, ... // 上と同じ構造
+//     - _layouts/, assets/, ... // WriteSiteFiles() (Config.SiteDirが空の場合)
+//
+// チャンネルの月毎のページを単位として最大g.workers個を並列に生成する。
+// チャンネルのindex.htmlのカレンダーは月毎のページを生成しながら集計した投稿
+// 数から作るため、全ての月毎のページの後に生成する。
+// ctxがキャンセルされた場合は未着手のページを生成せずに終了する。
+// 失敗したページがあれば、その全てを*PageErrorとしてまとめたエラーを返す。
+func (g *HTMLGenerator) Generate(ctx context.Context, outDir string) error {
+	// links to any message in any channel may appear in every page.
+	permalinks, err := newPermalinkIndex(ctx, g.s, &g.cfg, g.workers)
+	if err != nil {
+		return err
+	}
+	g.c.permalinks = permalinks
+	pageCounts, err := g.countPages(ctx)
+	if err != nil {
+		return err
+	}
+	g.pageCounts = pageCounts
+	if err := g.generatePages(ctx, outDir); err != nil {
+		return err
+	}
+	for _, locale := range g.cfg.ExtraLocales {
+		slog.Info("generating pages", "locale", locale)
+		if err := g.withLocale(locale).generatePages(ctx, filepath.Join(outDir, locale)); err != nil {
+			return err
+		}
+	}
+	if g.cfg.SiteDir == "" {
+		if _, err := WriteSiteFiles(outDir); err != nil {
+			return fmt.Errorf("failed to write site files: %w", err)
+		}
+	}
+	return nil
+}
+
+// withLocale : ページをlocaleで${locale}/以下に生成するHTMLGeneratorを返す。
+func (g *HTMLGenerator) withLocale(locale string) *HTMLGenerator {
+	lg := *g
+	lg.site = newSiteParams(&g.cfg, locale)
+	lg.catalog = catalogOf(locale)
+	lg.localePrefix = locale
+	return &lg
+}
+
+// generatePages : outDirにg.site.Localeのページを生成する。
+func (g *HTMLGenerator) generatePages(ctx context.Context, outDir string) error {
+	templates, err := g.loadTemplates()
+	if err != nil {
+		return err
+	}
+	g.templates = templates
+
 	channels := g.s.GetChannels()
 
+	// collect the months of every channel first, so that pages can be
+	// distributed to the workers at channel-month granularity.
+	keysList := make([][]MessageMonthKey, len(channels))
+	indices := make([]int, len(channels))
+	for i := range indices {
+		indices[i] = i
+	}
+	err = runParallel(ctx, g.workers, indices, func(ctx context.Context, i int) error {
+		keys, err := g.s.GetMonthKeys(channels[i].ID)
+		if err != nil {
+			slog.Error("GetMonthKeys failed", "channel", channels[i].ID, "err", err)
+			return &PageError{ChannelID: channels[i].ID, Err: err}
+		}
+		keysList[i] = keys
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	g.activity = newActivityCollector()
+	g.dates = newDateIndex()
+	g.documents = newDocumentIndex()
 	createdChannels := []Channel{}
-	var (
-		wg   sync.WaitGroup
-		mu   sync.Mutex
-		errs []error
-	)
+	var tasks []generateTask
+	for i, channel := range channels {
+		if len(keysList[i]) == 0 {
+			continue
+		}
+		createdChannels = append(createdChannels, channel)
+		for _, key := range keysList[i] {
+			tasks = append(tasks, generateTask{channel: channel, key: key})
+		}
+	}
+
+	progress := NewProgress(ctx, "months", "generated", len(tasks))
+	err = runParallel(ctx, g.workers, tasks, func(ctx context.Context, task generateTask) error {
+		err := g.generateTask(outDir, task)
+		if err != nil {
+			progress.Fail()
+			key := task.key
+			slog.Error("generate failed", "channel", task.channel.ID, "month", key.Year()+"-"+key.Month(), "err", err)
+			err = &PageError{ChannelID: task.channel.ID, Month: &key, Err: err}
+		} else {
+			progress.Done(0)
+		}
+		return err
+	})
+	progress.Finish()
+	if err != nil {
+		return err
+	}
+
+	indices = indices[:0]
 	for i := range channels {
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			isCreated, err := g.generateChannelDir(
-				filepath.Join(outDir, channels[i].ID),
-				channels[i],
-			)
-			if err != nil {
-				log.Printf("generateChannelDir(%s) failed: %s", channels[i].ID, err)
-				mu.Lock()
-				errs = append(errs, err)
-				mu.Unlock()
-				return
-			}
-			if isCreated {
-				mu.Lock()
-				createdChannels = append(createdChannels, channels[i])
-				mu.Unlock()
-			}
-		}(i)
+		if len(keysList[i]) > 0 {
+			indices = append(indices, i)
+		}
 	}
-	wg.Wait()
-	if len(errs) > 0 {
-		return errs[0]
+	err = runParallel(ctx, g.workers, indices, func(ctx context.Context, i int) error {
+		path := filepath.Join(outDir, channels[i].ID)
+		err := g.generateChannelIndex(channels[i], keysList[i], filepath.Join(path, "index.html"))
+		if err != nil {
+			slog.Error("generate failed", "channel", channels[i].ID, "err", err)
+			err = &PageError{ChannelID: channels[i].ID, Err: err}
+		}
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
-	if err := g.generateIndex(filepath.Join(outDir, "index.html"), createdChannels); err != nil {
+	if g.cfg.TimelinePages {
+		keysOf := map[string][]MessageMonthKey{}
+		for i, channel := range channels {
+			keysOf[channel.ID] = keysList[i]
+		}
+		if err := g.generateTimeline(ctx, filepath.Join(outDir, "timeline"), createdChannels, keysOf); err != nil {
+			return err
+		}
+	}
+
+	if err := g.generateDocuments(filepath.Join(outDir, "documents")); err != nil {
 		return err
 	}
 
-	return nil
-}
+	if err := g.generateUserPages(filepath.Join(outDir, "users")); err != nil {
+		return err
+	}
 
-func (g *HTMLGenerator) generateIndex(path string, channels []Channel) error {
-	params := make(map[string]interface{})
-	SortChannel(channels)
-	params["channels"] = channels
-	tmplPath := filepath.Join(g.templateDir, "index.tmpl")
-	name := filepath.Base(tmplPath)
-	t, err := template.New(name).Delims("<<", ">>").ParseFiles(tmplPath)
-	if err != nil {
+	if err := g.generatePermalinkPage(filepath.Join(outDir, "permalink"), createdChannels); err != nil {
 		return err
 	}
-	if err := executeAndWrite(t, params, path); err != nil {
+
+	if g.cfg.StatsPage {
+		st, err := ComputeStats(ctx, g.s)
+		if err != nil {
+			return err
+		}
+		if err := g.generateStats(filepath.Join(outDir, "stats"), st); err != nil {
+			return err
+		}
+	}
+
+	if err := g.generateIndex(filepath.Join(outDir, "index.html"), createdChannels); err != nil {
 		return err
 	}
+
 	return nil
 }
 
-func (g *HTMLGenerator) generateChannelDir(path string, channel Channel) (bool, error) {
-	msgsMap, err := g.s.GetMessagesPerMonth(channel.ID)
+func (g *HTMLGenerator) generateTask(outDir string, task generateTask) error {
+	// load, render and release one month at a time so that the whole history
+	// of the channel is never held in memory.
+	key := task.key
+	msgs, err := g.s.GetMessagesOfMonth(task.channel.ID, key)
 	if err != nil {
-		return false, err
+		return err
 	}
-	if len(msgsMap) == 0 {
-		return false, nil
+	defer g.s.ReleaseMonth(task.channel.ID, key)
+	path := filepath.Join(outDir, task.channel.ID, key.Year(), key.Month())
+	pages, chunks := g.paginate(task.channel, key, msgs, g.cfg.MessagesPerPage)
+	for i, page := range pages {
+		dir := path
+		if page.Num > 1 {
+			dir = filepath.Join(path, "page", strconv.Itoa(page.Num))
+		}
+		if err := g.generateMessageDir(task.channel, key, chunks[i], nil, page, dir); err != nil {
+			return err
+		}
 	}
-
-	if err := os.MkdirAll(path, 0777); err != nil {
-		return false, fmt.Errorf("could not create %s directory: %w", path, err)
+	if len(pages) > 1 {
+		if err := pages[0].writeTsMap(path); err != nil {
+			return err
+		}
+	}
+	if g.cfg.DayPages {
+		if err := g.generateDayPages(task.channel, key, msgs, pages[0], path); err != nil {
+			return err
+		}
 	}
+	g.collectMonth(task.channel, key, msgs, pages[0])
+	return nil
+}
 
-	keys := make([]MessageMonthKey, 0, len(msgsMap))
-	for key := range msgsMap {
-		keys = append(keys, key)
+// collectMonth : keyの月のページに表示したメッセージを、ユーザページと日毎の投
+// 稿数のために集計する。
+// スレッドへの返信も、先頭のメッセージのページに表示されたものとして数える。
+// 返信のみの日のカレンダーは、その返信を表示するpageのページへリンクする。
+// チャンネルにも投稿された返信はチャンネル側のものとして一度だけ数える。
+func (g *HTMLGenerator) collectMonth(channel Channel, key MessageMonthKey, msgs []Message, page *MonthPage) {
+	for i := range msgs {
+		msg := &msgs[i]
+		g.dates.add(channel.ID, *msg, g.isVisibleMessage(*msg))
+		g.documents.add(channel, key, *msg)
+		if u := g.userOf(msg); u != nil {
+			g.activity.add(u, channel, key, *msg)
+		}
+		if !msg.IsRootOfThread() {
+			continue
+		}
+		t, ok := g.s.GetThread(channel.ID, msg.Ts)
+		if !ok {
+			continue
+		}
+		for _, reply := range t.Replies() {
+			if reply.Subtype == "thread_broadcast" {
+				continue
+			}
+			g.dates.addReply(channel.ID, reply, g.replyURL(page, *msg, reply))
+			g.documents.add(channel, key, reply)
+			if u := g.userOf(&reply); u != nil {
+				g.activity.add(u, channel, key, reply)
+			}
+		}
 	}
+}
 
-	if err := g.generateChannelIndex(
-		channel,
-		keys,
-		filepath.Join(path, "index.html"),
-	); err != nil {
-		return true, err
+// replyURL : rootを先頭とするスレッドへの返信replyを表示するページへのリンクを
+// 返す。日毎のページを生成する場合はrootの日のページとなる。
+func (g *HTMLGenerator) replyURL(page *MonthPage, root, reply Message) string {
+	if g.cfg.DayPages {
+		return fmt.Sprintf("%s%02d/#ts-%s", page.base, TsToDateTime(root.Ts).Day(), reply.Ts)
 	}
+	return page.TsLink(reply.Ts)
+}
 
-	for key, mm := range msgsMap {
-		if err := g.generateMessageDir(
-			channel,
-			key,
-			mm,
-			filepath.Join(path, key.Year(), key.Month()),
-		); err != nil {
-			return true, err
-		}
+func (g *HTMLGenerator) generateIndex(path string, channels []Channel) error {
+	params := make(map[string]interface{})
+	SortChannel(channels)
+	params["channels"] = channels
+	params["statsPage"] = g.cfg.StatsPage
+	params["timelinePage"] = g.cfg.TimelinePages
+	if err := g.executeAndWrite("index.tmpl", params, path); err != nil {
+		return err
 	}
-	return true, nil
+	return nil
 }
 
 func (g *HTMLGenerator) generateChannelIndex(channel Channel, keys []MessageMonthKey, path string) error {
-
-	sort.Slice(keys, func(i, j int) bool {
-		if keys[i].year < keys[j].year {
-			return true
-		}
-		return keys[i].month < keys[j].month
-	})
+	keys = append([]MessageMonthKey(nil), keys...)
+	sortMessageMonthKeys(keys)
 
 	params := make(map[string]interface{})
 	params["channel"] = channel
 	params["keys"] = keys
-
-	tempPath := filepath.Join(g.templateDir, "channel_index.tmpl")
-	name := filepath.Base(tempPath)
-	t, err := template.New(name).Delims("<<", ">>").ParseFiles(tempPath)
-	if err != nil {
-		return err
+	dayURL := func(t time.Time) string {
+		url := fmt.Sprintf("{{ site.baseurl }}/%s/%04d/%02d/", channel.ID, t.Year(), t.Month())
+		if g.cfg.DayPages {
+			url += fmt.Sprintf("%02d/", t.Day())
+		}
+		return url
 	}
-	if err := executeAndWrite(t, params, path); err != nil {
+	params["calendar"] = buildCalendar(g.dates.channelCounts(channel.ID), func(t time.Time) string {
+		return g.dates.dayLink(channel.ID, t, dayURL)
+	})
+
+	if err := g.executeAndWrite("channel_index.tmpl", params, path); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (g *HTMLGenerator) generateMessageDir(channel Channel, key MessageMonthKey, msgs []Message, path string) error {
+// statsTopN : 統計ページに表示するユーザや絵文字の最大数
+const statsTopN = 50
+
+func (g *HTMLGenerator) generateStats(path string, st *Stats) error {
+	if err := os.MkdirAll(path, 0777); err != nil {
+		return fmt.Errorf("could not create %s directory: %w", path, err)
+	}
+
+	params := make(map[string]interface{})
+	params["stats"] = st
+	topUsers := st.Users
+	if len(topUsers) > statsTopN {
+		topUsers = topUsers[:statsTopN]
+	}
+	params["topUsers"] = topUsers
+	topEmojis := st.Emojis
+	if len(topEmojis) > statsTopN {
+		topEmojis = topEmojis[:statsTopN]
+	}
+	params["topEmojis"] = topEmojis
+
+	maxMonthMessages := 0
+	for _, m := range st.Months {
+		if m.Messages > maxMonthMessages {
+			maxMonthMessages = m.Messages
+		}
+	}
+	params["maxMonthMessages"] = maxMonthMessages
+	params["maxChannelMessages"] = 0
+	if len(st.Channels) > 0 {
+		params["maxChannelMessages"] = st.Channels[0].Messages
+	}
+	params["maxUserMessages"] = 0
+	if len(topUsers) > 0 {
+		params["maxUserMessages"] = topUsers[0].Messages
+	}
+	params["maxEmojiTotal"] = 0
+	if len(topEmojis) > 0 {
+		params["maxEmojiTotal"] = topEmojis[0].Total()
+	}
+	maxFiletypeFiles := 0
+	for _, ft := range st.Filetypes {
+		if ft.Files > maxFiletypeFiles {
+			maxFiletypeFiles = ft.Files
+		}
+	}
+	params["maxFiletypeFiles"] = maxFiletypeFiles
+
+	return g.executeAndWrite("stats.tmpl", params, filepath.Join(path, "index.html"))
+}
+
+// generateMessageDir : チャンネルのkeyの月のページをpath/index.htmlに生成する。
+// pageは月のページを分けた場合のうちの一ページで、msgsはそのページのメッセージ
+// である。
+// dayがnilでなければ、msgsはその日のメッセージであり日毎のページとなる。
+func (g *HTMLGenerator) generateMessageDir(channel Channel, key MessageMonthKey, msgs []Message, day *DayPage, page *MonthPage, path string) error {
 	if err := os.MkdirAll(path, 0777); err != nil {
 		return fmt.Errorf("could not create %s directory: %w", path, err)
 	}
@@ -177,91 +460,67 @@ func (g *HTMLGenerator) generateMessageDir(channel Channel, key MessageMonthKey,
 	params["channel"] = channel
 	params["monthKey"] = key
 	params["msgs"] = msgs
+	params["day"] = day
+	params["page"] = page.withMessages(msgs)
 
 	// TODO check below subtypes work correctly
 	// TODO support more subtypes
-	tmplPath := filepath.Join(g.templateDir, "channel_per_month_index.tmpl")
-	name := filepath.Base(tmplPath)
-	t, err := template.New(name).
-		Delims("<<", ">>").
-		Funcs(map[string]interface{}{
-			"visible": g.isVisibleMessage,
-			"datetime": func(ts string) string {
-				return TsToDateTime(ts).Format("2日 15:04:05")
-			},
-			"slackPermalink": func(ts string) string {
-				return strings.Replace(ts, ".", "", 1)
-			},
-			"username": func(msg *Message) string {
-				if msg.Subtype == "bot_message" || msg.Subtype == "slackbot_response" {
-					return g.c.escapeSpecialChars(msg.Username)
-				}
-				return g.c.escapeSpecialChars(g.s.GetDisplayNameByUserID(msg.User))
-			},
-			"userIconUrl": func(msg *Message) string {
-				switch msg.Subtype {
-				case "", "thread_broadcast":
-					user, ok := g.s.GetUserByID(msg.User)
-					if !ok {
-						return "" // TODO show default icon
-					}
-					return user.Profile.Image48
-				case "bot_message", "slackbot_response":
-					if msg.Icons != nil && msg.Icons.Image48 != "" {
-						return msg.Icons.Image48
-					}
-				}
-				return ""
-			},
-			"text":           g.generateMessageText,
-			"attachmentText": g.generateAttachmentText,
-			"threadMtime": func(ts string) string {
-				if t, ok := g.s.GetThread(channel.ID, ts); ok {
-					return t.LastReplyTime().Format("2日 15:04:05")
-				}
-				return ""
-			},
-			"threads": func(ts string) []Message {
-				if t, ok := g.s.GetThread(channel.ID, ts); ok {
-					return t.Replies()
-				}
-				return nil
-			},
-			"threadNum": func(ts string) int {
-				if t, ok := g.s.GetThread(channel.ID, ts); ok {
-					return t.ReplyCount()
-				}
-				return 0
-			},
-			"threadRootText": func(ts string) string {
-				thread, ok := g.s.GetThread(channel.ID, ts)
-				if !ok {
-					return ""
-				}
-				runes := []rune(thread.RootText())
-				text := string(runes)
-				if len(runes) > 20 {
-					text = string(runes[:20]) + " ..."
-				}
-				return g.c.escape(text)
-			},
-			"hasPrevMonth": func(key MessageMonthKey) bool {
-				return g.s.HasPrevMonth(channel.ID, key)
-			},
-			"hasNextMonth": func(key MessageMonthKey) bool {
-				return g.s.HasNextMonth(channel.ID, key)
-			},
-		}).ParseFiles(tmplPath)
+	err := g.executeAndWrite("channel_per_month_index.tmpl", params, filepath.Join(path, "index.html"))
 	if err != nil {
 		return err
 	}
-	err = executeAndWrite(t, params, filepath.Join(path, "index.html"))
-	if err != nil {
-		return err
+	return nil
+}
+
+// generateDayPages : keyの月のメッセージmsgsを日毎に分け、それぞれの日のページ
+// をpath/${DD}/index.htmlに生成する。
+// monthは月の最初のページで、他の日にあるメッセージへのリンクに用いる。
+func (g *HTMLGenerator) generateDayPages(channel Channel, key MessageMonthKey, msgs []Message, month *MonthPage, path string) error {
+	page := &MonthPage{Num: 1, Total: 1, channelID: month.channelID, key: month.key, base: month.base, pageOf: month.pageOf}
+	days, perDay := splitByDay(msgs)
+	for i, d := range days {
+		day := &DayPage{Day: d}
+		if i > 0 {
+			day.Prev = days[i-1]
+		}
+		if i < len(days)-1 {
+			day.Next = days[i+1]
+		}
+		if err := g.generateMessageDir(channel, key, perDay[d], day, page, filepath.Join(path, day.Dir())); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// userName : メッセージの投稿者の表示名をエスケープして返す。
+func (g *HTMLGenerator) userName(msg *Message) string {
+	if msg.IsBotMessage() {
+		return g.c.escapeSpecialChars(ResolveBotIdentity(msg, g.s.GetUserByID).Name)
+	}
+	name := g.s.GetDisplayNameByUserID(msg.User)
+	if name == "" && msg.BotProfile != nil {
+		// posted by an app as its bot user, which is not in users.json.
+		name = msg.BotProfile.Name
+	}
+	return g.c.escapeSpecialChars(name)
+}
+
+// userIconURL : メッセージの投稿者のアイコンのURLを返す。
+func (g *HTMLGenerator) userIconURL(msg *Message) string {
+	if msg.IsBotMessage() {
+		return ResolveBotIdentity(msg, g.s.GetUserByID).Icon
+	}
+	user, ok := g.s.GetUserByID(msg.User)
+	if ok {
+		return user.Profile.Image48
+	}
+	if msg.BotProfile != nil && msg.BotProfile.Icons != nil {
+		return msg.BotProfile.Icons.Image48
+	}
+	return "" // TODO show default icon
+}
+
 func (g *HTMLGenerator) isVisibleMessage(msg Message) bool {
 	return msg.Subtype == "" || msg.Subtype == "bot_message" || msg.Subtype == "slackbot_response" || msg.Subtype == "thread_broadcast"
 }
@@ -278,16 +537,23 @@ func (g *HTMLGenerator) generateAttachmentText(attachment MessageAttachment) str
 	return g.c.ToHTML(attachment.Text)
 }
 
-// executeAndWrite executes a template and writes contents to a file.
-func executeAndWrite(tmpl *template.Template, data interface{}, filename string) error {
-	f, err := os.Create(filename)
-	if err != nil {
-		return err
+// attachmentColors : 添付のcolorに指定できる名前と、その色
+var attachmentColors = map[string]string{
+	"good":    "#2eb886",
+	"warning": "#daa038",
+	"danger":  "#a30200",
+}
+
+var reHexColor = regexp.MustCompile(`^#?([0-9A-Fa-f]{3}|[0-9A-Fa-f]{6})$`)
+
+// attachmentColor : 添付のcolorをCSSの色に変換する。不正な値の場合は空文字列を
+// 返す。
+func attachmentColor(color string) string {
+	if c, ok := attachmentColors[color]; ok {
+		return c
 	}
-	defer f.Close()
-	err = tmpl.Execute(f, data)
-	if err != nil {
-		return err
+	if m := reHexColor.FindStringSubmatch(color); m != nil {
+		return "#" + m[1]
 	}
-	return nil
+	return ""
 }
@@ -0,0 +1,70 @@
+package slacklog
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// highlightStyle : ハイライトに用いるchromaのスタイル。
+// HTMLにはクラス名のみを出力するため、色はこのスタイルから生成した
+// site/assets/css/highlight.cssで指定する。
+const highlightStyle = "github"
+
+// reLangTag : コードブロックの一行目に書かれた言語名にマッチする。
+var reLangTag = regexp.MustCompile(`^[A-Za-z0-9_+#.-]+$`)
+
+// lexerByName : 言語名、エイリアスまたはファイル名の拡張子からlexerを返す。
+// 見つからない場合はnilを返す。
+func lexerByName(name string) chroma.Lexer {
+	if name == "" {
+		return nil
+	}
+	if l := lexers.Get(name); l != nil && l != lexers.Fallback {
+		return l
+	}
+	return nil
+}
+
+// detectCodeLexer : メッセージ中のコードブロックcodeの言語を判定し、lexerと言語
+// 名の行を除いたコードを返す。
+// 一行目に言語名だけが書かれていればそれを用い、なければ内容から推測する。判定で
+// きない場合はnilを返す。
+func detectCodeLexer(code string) (chroma.Lexer, string) {
+	if i := strings.IndexByte(code, '\n'); i > 0 {
+		first := strings.TrimSpace(code[:i])
+		if reLangTag.MatchString(first) {
+			if l := lexerByName(first); l != nil {
+				return l, code[i+1:]
+			}
+		}
+	}
+	return lexers.Analyse(code), code
+}
+
+// highlightCode : codeをlexerでハイライトしたHTML(<pre class="chroma">)を返す。
+// lineNumbersがtrueの場合はbaseLineから始まる行番号を付ける。失敗した場合は
+// falseを返す。
+// 生成したHTMLはJekyllで処理されるため、"{{"と"{%"は実体参照にする。
+func highlightCode(code string, lexer chroma.Lexer, lineNumbers bool, baseLine int) (string, bool) {
+	it, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return "", false
+	}
+	f := chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.WithLineNumbers(lineNumbers),
+		chromahtml.BaseLineNumber(baseLine),
+	)
+	var buf bytes.Buffer
+	if err := f.Format(&buf, styles.Get(highlightStyle), it); err != nil {
+		return "", false
+	}
+	s := strings.Replace(buf.String(), "{{", "&#123;&#123;", -1)
+	return strings.Replace(s, "{%", "&#123;&#37;", -1), true
+}
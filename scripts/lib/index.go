@@ -0,0 +1,273 @@
+package slacklog
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// channelIndex : チャンネルのメッセージファイルを一度だけ走査して作る索引。
+// メッセージ本体は保持せず、月毎のファイル名とスレッド毎にそのメッセージを含む
+// ファイル名のみを保持する。
+// メッセージは月単位でloadMonth()により読み込み、release()で解放する。そのため
+// チャンネルの全履歴を同時にメモリに置くことはない。
+type channelIndex struct {
+	dir string
+	// key: month, value: sorted day file names
+	files map[MessageMonthKey][]string
+	// チャンネルに表示するメッセージが存在する月(昇順)
+	months []MessageMonthKey
+	shown  map[MessageMonthKey]struct{}
+	// key: thread timestamp, value: sorted day file names
+	threadFiles map[string][]string
+	// key: thread timestamp, value: the month of the root message
+	threadRoots map[string]MessageMonthKey
+
+	mu sync.Mutex
+	// loadMonth()で読み込んだ、その月が先頭のスレッド
+	// key: month, thread timestamp
+	loaded map[MessageMonthKey]map[string]*Thread
+}
+
+// indexEntry : 索引の作成に必要なメッセージの項目のみを読み込むための構造体。
+type indexEntry struct {
+	Ts       string `json:"ts"`
+	ThreadTs string `json:"thread_ts"`
+	Subtype  string `json:"subtype"`
+}
+
+// newChannelIndex : dirに置かれたメッセージファイルを走査してchannelIndexを生成
+// する。
+// ファイル名の"YYYY-MM"の部分から月を判定する。
+func newChannelIndex(dir string) (*channelIndex, error) {
+	names, err := readDirNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	idx := &channelIndex{
+		dir:         dir,
+		files:       map[MessageMonthKey][]string{},
+		shown:       map[MessageMonthKey]struct{}{},
+		threadFiles: map[string][]string{},
+		threadRoots: map[string]MessageMonthKey{},
+		loaded:      map[MessageMonthKey]map[string]*Thread{},
+	}
+	for _, name := range names {
+		match := reMsgFilename.FindStringSubmatch(name)
+		if len(match) == 0 {
+			slog.Warn("skipping a file not named YYYY-MM-DD.json", "path", filepath.Join(dir, name))
+			continue
+		}
+		key, err := NewMessageMonthKey(match[1], match[2])
+		if err != nil {
+			return nil, err
+		}
+		idx.files[key] = append(idx.files[key], name)
+		err = ReadFileAsJSONArray(filepath.Join(dir, name), func(e indexEntry) error {
+			msg := Message{Ts: e.Ts, ThreadTs: e.ThreadTs, Subtype: e.Subtype}
+			if !msg.IsVisible() {
+				return nil
+			}
+			if msg.IsShownInChannel() {
+				idx.shown[key] = struct{}{}
+			}
+			if msg.IsRootOfThread() {
+				idx.threadRoots[msg.ThreadTs] = key
+			}
+			if msg.ThreadTs != "" {
+				files := idx.threadFiles[msg.ThreadTs]
+				if len(files) == 0 || files[len(files)-1] != name {
+					idx.threadFiles[msg.ThreadTs] = append(files, name)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s: %w", name, err)
+		}
+	}
+	for key := range idx.shown {
+		idx.months = append(idx.months, key)
+	}
+	sortMessageMonthKeys(idx.months)
+	return idx, nil
+}
+
+// loadMonth : keyの月のメッセージファイルを読み込み、チャンネルに表示するメッ
+// セージを投稿時刻順に返す。
+// その月が先頭のスレッドは、他の月に含まれる返信も含めて読み込み、release()を
+// 呼ぶまでthread()で取得できるようにする。
+func (idx *channelIndex) loadMonth(key MessageMonthKey) ([]Message, error) {
+	mt := NewMessageTable()
+	paths := make([]string, len(idx.files[key]))
+	for i, name := range idx.files[key] {
+		paths[i] = filepath.Join(idx.dir, name)
+	}
+	if err := mt.ReadLogFiles(paths...); err != nil {
+		return nil, err
+	}
+	msgs := mt.MsgsMap[key]
+
+	threads := map[string]*Thread{}
+	var extraFiles []string
+	seen := map[string]struct{}{}
+	for _, name := range idx.files[key] {
+		seen[name] = struct{}{}
+	}
+	for ts, t := range mt.ThreadMap {
+		if t.rootMsg == nil {
+			// the root is in a previous month.
+			continue
+		}
+		threads[ts] = t
+		for _, name := range idx.threadFiles[ts] {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				extraFiles = append(extraFiles, name)
+			}
+		}
+	}
+	// replies posted in later months.
+	sort.Strings(extraFiles)
+	for _, name := range extraFiles {
+		fileKey := monthKeyOfFile(name)
+		err := ReadFileAsJSONArray(filepath.Join(idx.dir, name), func(msg Message) error {
+			if !msg.IsVisible() || msg.IsRootOfThread() {
+				return nil
+			}
+			if t, ok := threads[msg.ThreadTs]; ok {
+				t.add(fileKey, msg)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s: %w", name, err)
+		}
+	}
+
+	idx.mu.Lock()
+	idx.loaded[key] = threads
+	idx.mu.Unlock()
+	return msgs, nil
+}
+
+// release : loadMonth()で読み込んだkeyの月のデータを解放する。
+func (idx *channelIndex) release(key MessageMonthKey) {
+	idx.mu.Lock()
+	delete(idx.loaded, key)
+	idx.mu.Unlock()
+}
+
+// thread : tsを先頭とするスレッドを返す。
+// loadMonth()で読み込み済みでなければ、そのスレッドを含むファイルのみを読み込
+// む。その場合は結果を保持しない。
+func (idx *channelIndex) thread(ts string) (*Thread, bool) {
+	idx.mu.Lock()
+	for _, threads := range idx.loaded {
+		if t, ok := threads[ts]; ok {
+			idx.mu.Unlock()
+			return t, true
+		}
+	}
+	idx.mu.Unlock()
+
+	files, ok := idx.threadFiles[ts]
+	if !ok {
+		return nil, false
+	}
+	t := newThread(ts)
+	for _, name := range files {
+		key := monthKeyOfFile(name)
+		err := ReadFileAsJSONArray(filepath.Join(idx.dir, name), func(msg Message) error {
+			if !msg.IsVisible() || msg.ThreadTs != ts {
+				return nil
+			}
+			t.add(key, msg)
+			return nil
+		})
+		if err != nil {
+			slog.Warn("failed to read thread", "path", filepath.Join(idx.dir, name), "err", err)
+			return nil, false
+		}
+	}
+	return t, true
+}
+
+// continuedThreads : keyより前の月に先頭メッセージがあり、keyの月にも返信が投稿
+// されたスレッドを先頭のtsの順に返す。
+func (idx *channelIndex) continuedThreads(key MessageMonthKey) []*Thread {
+	inMonth := map[string]struct{}{}
+	for _, name := range idx.files[key] {
+		inMonth[name] = struct{}{}
+	}
+	var tss []string
+	for ts, files := range idx.threadFiles {
+		if root, ok := idx.threadRoots[ts]; !ok || !root.before(key) {
+			continue
+		}
+		for _, name := range files {
+			if _, ok := inMonth[name]; ok {
+				tss = append(tss, ts)
+				break
+			}
+		}
+	}
+	sort.Strings(tss)
+	threads := make([]*Thread, 0, len(tss))
+	for _, ts := range tss {
+		if t, ok := idx.thread(ts); ok {
+			threads = append(threads, t)
+		}
+	}
+	return threads
+}
+
+// messageMonths : チャンネルのページに表示する全てのメッセージのtsと、それを表
+// 示する月を返す。
+// 索引と同じく、メッセージ本体は読み込まずに必要な項目のみを読み込む。
+func (idx *channelIndex) messageMonths() (map[string]MessageMonthKey, error) {
+	months := map[string]MessageMonthKey{}
+	for key, names := range idx.files {
+		for _, name := range names {
+			err := ReadFileAsJSONArray(filepath.Join(idx.dir, name), func(e indexEntry) error {
+				msg := Message{Ts: e.Ts, ThreadTs: e.ThreadTs, Subtype: e.Subtype}
+				if !msg.IsVisible() {
+					return nil
+				}
+				if msg.IsShownInChannel() {
+					months[msg.Ts] = key
+				} else if root, ok := idx.threadRoots[msg.ThreadTs]; ok {
+					months[msg.Ts] = root
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal %s: %w", name, err)
+			}
+		}
+	}
+	return months, nil
+}
+
+// monthKeyOfFile : 索引に含まれる"YYYY-MM-DD.json"の名前のファイルの年月を返
+// す。
+func monthKeyOfFile(name string) MessageMonthKey {
+	match := reMsgFilename.FindStringSubmatch(name)
+	key, _ := NewMessageMonthKey(match[1], match[2])
+	return key
+}
+
+func sortMessages(msgs []Message) {
+	sort.SliceStable(msgs, func(i, j int) bool {
+		// must be the same digits, so no need to convert the timestamp to a number
+		return msgs[i].Ts < msgs[j].Ts
+	})
+}
+
+func sortMessageMonthKeys(keys []MessageMonthKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].before(keys[j])
+	})
+}
@@ -2,6 +2,7 @@ package slacklog
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 )
 
@@ -19,3 +20,33 @@ func ReadFileAsJSON(filename string, dst interface{}) error {
 	}
 	return nil
 }
+
+// ReadFileAsJSONArray reads a file containing a JSON array and calls `fn` for
+// each element in order. Unlike ReadFileAsJSON, it decodes one element at a
+// time, so the whole array is never held in memory.
+func ReadFileAsJSONArray[T any](filename string, fn func(elem T) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("%s: expected JSON array but got %v", filename, tok)
+	}
+	for dec.More() {
+		var elem T
+		if err := dec.Decode(&elem); err != nil {
+			return err
+		}
+		if err := fn(elem); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
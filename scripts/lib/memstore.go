@@ -0,0 +1,196 @@
+package slacklog
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MemoryLogStore : メモリ上に直接登録したデータを返すLogStore。
+// ファイルやデータベースを用意せずにHTMLGeneratorなどを動かすためのもので、主
+// にテストでの利用を想定している。
+type MemoryLogStore struct {
+	ut     *UserTable
+	ct     *ChannelTable
+	emojis map[string]string
+	// key: channel ID
+	mts map[string]*MessageTable
+}
+
+// NewMemoryLogStore : 空のMemoryLogStoreを生成する。
+func NewMemoryLogStore() *MemoryLogStore {
+	return &MemoryLogStore{
+		ut:     newUserTable(nil),
+		ct:     newChannelTable(nil, []string{"*"}),
+		emojis: map[string]string{},
+		mts:    map[string]*MessageTable{},
+	}
+}
+
+// AddChannels : チャンネルを追加する。
+func (s *MemoryLogStore) AddChannels(channels ...Channel) {
+	s.ct = newChannelTable(append(s.ct.Channels, channels...), []string{"*"})
+	for _, ch := range channels {
+		if _, ok := s.mts[ch.ID]; !ok {
+			s.mts[ch.ID] = NewMessageTable()
+		}
+	}
+}
+
+// AddUsers : ユーザを追加する。
+func (s *MemoryLogStore) AddUsers(users ...User) {
+	s.ut = newUserTable(append(s.ut.Users, users...))
+}
+
+// AddEmoji : 絵文字を追加する。valueはEmojiTableと同じく拡張子もしくは
+// "alias:"から始まる別名である。
+func (s *MemoryLogStore) AddEmoji(name, value string) {
+	s.emojis[name] = value
+}
+
+// AddMessages : channelIDのチャンネルにメッセージを追加する。
+// メッセージはtsから求めた投稿月に振り分けられる。
+// チャンネルは事前にAddChannels()で追加しておく必要がある。
+func (s *MemoryLogStore) AddMessages(channelID string, msgs ...Message) error {
+	mt, ok := s.mts[channelID]
+	if !ok {
+		return fmt.Errorf("not found channel: id=%s", channelID)
+	}
+	perMonth := map[MessageMonthKey][]Message{}
+	for _, msg := range msgs {
+		key := monthKeyOfTs(msg.Ts)
+		perMonth[key] = append(perMonth[key], msg)
+	}
+	for key, msgs := range perMonth {
+		mt.AddMessages(key, msgs)
+	}
+	return nil
+}
+
+func (s *MemoryLogStore) GetChannels() []Channel {
+	return s.ct.Channels
+}
+
+func (s *MemoryLogStore) HasNextMonth(channelID string, key MessageMonthKey) bool {
+	if mt, ok := s.mts[channelID]; ok {
+		_, ok := mt.MsgsMap[key.Next()]
+		return ok
+	}
+	return false
+}
+
+func (s *MemoryLogStore) HasPrevMonth(channelID string, key MessageMonthKey) bool {
+	if mt, ok := s.mts[channelID]; ok {
+		_, ok := mt.MsgsMap[key.Prev()]
+		return ok
+	}
+	return false
+}
+
+func (s *MemoryLogStore) GetMessagesPerMonth(channelID string) (map[MessageMonthKey][]Message, error) {
+	mt, ok := s.mts[channelID]
+	if !ok {
+		return nil, fmt.Errorf("not found channel: id=%s", channelID)
+	}
+	return mt.MsgsMap, nil
+}
+
+func (s *MemoryLogStore) GetUserByID(userID string) (*User, bool) {
+	u, ok := s.ut.UserMap[userID]
+	return u, ok
+}
+
+func (s *MemoryLogStore) GetDisplayNameByUserID(userID string) string {
+	return s.ut.DisplayName(userID)
+}
+
+func (s *MemoryLogStore) GetDisplayNameMap() map[string]string {
+	ret := make(map[string]string, len(s.ut.UserMap))
+	for id := range s.ut.UserMap {
+		ret[id] = s.ut.DisplayName(id)
+	}
+	return ret
+}
+
+func (s *MemoryLogStore) GetEmojiMap() map[string]string {
+	return s.emojis
+}
+
+func (s *MemoryLogStore) GetThread(channelID, ts string) (*Thread, bool) {
+	mt, ok := s.mts[channelID]
+	if !ok {
+		return nil, false
+	}
+	t, ok := mt.ThreadMap[ts]
+	return t, ok
+}
+
+func (s *MemoryLogStore) GetContinuedThreads(channelID string, key MessageMonthKey) []*Thread {
+	mt, ok := s.mts[channelID]
+	if !ok {
+		return nil
+	}
+	var threads []*Thread
+	for _, t := range mt.ThreadMap {
+		if !t.HasRoot() || !t.RootMonth().before(key) {
+			continue
+		}
+		for _, k := range t.Months() {
+			if k == key {
+				threads = append(threads, t)
+				break
+			}
+		}
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		return threads[i].Ts() < threads[j].Ts()
+	})
+	return threads
+}
+
+func (s *MemoryLogStore) GetMessageMonths(channelID string) (map[string]MessageMonthKey, error) {
+	mt, ok := s.mts[channelID]
+	if !ok {
+		return nil, fmt.Errorf("not found channel: id=%s", channelID)
+	}
+	months := map[string]MessageMonthKey{}
+	for _, t := range mt.ThreadMap {
+		if !t.HasRoot() {
+			continue
+		}
+		for _, msg := range t.Replies() {
+			months[msg.Ts] = t.RootMonth()
+		}
+	}
+	// messages shown in the channel take precedence over the replies.
+	for key, msgs := range mt.MsgsMap {
+		for _, msg := range msgs {
+			months[msg.Ts] = key
+		}
+	}
+	return months, nil
+}
+
+func (s *MemoryLogStore) GetMonthKeys(channelID string) ([]MessageMonthKey, error) {
+	mt, ok := s.mts[channelID]
+	if !ok {
+		return nil, fmt.Errorf("not found channel: id=%s", channelID)
+	}
+	keys := make([]MessageMonthKey, 0, len(mt.MsgsMap))
+	for key := range mt.MsgsMap {
+		keys = append(keys, key)
+	}
+	sortMessageMonthKeys(keys)
+	return keys, nil
+}
+
+func (s *MemoryLogStore) GetMessagesOfMonth(channelID string, key MessageMonthKey) ([]Message, error) {
+	mt, ok := s.mts[channelID]
+	if !ok {
+		return nil, fmt.Errorf("not found channel: id=%s", channelID)
+	}
+	return mt.MsgsMap[key], nil
+}
+
+// ReleaseMonth : MemoryLogStoreは全データを保持し続けるため何もしない。
+func (s *MemoryLogStore) ReleaseMonth(channelID string, key MessageMonthKey) {
+}
@@ -1,14 +1,15 @@
 package slacklog
 
 import (
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/url"
-	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // MessageTable : メッセージデータを保持する
@@ -41,20 +42,32 @@ func NewMessageTable() *MessageTable {
 // を読み込む。
 // すでにそのディレクトリが読み込み済みの場合は処理をスキップする。
 func (m *MessageTable) ReadLogDir(path string) error {
-	dir, err := os.Open(path)
+	names, err := readDirNames(path)
 	if err != nil {
 		return err
 	}
-	defer dir.Close()
-	names, err := dir.Readdirnames(0)
-	if err != nil {
-		return err
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(path, name)
 	}
-	sort.Strings(names)
-	for _, name := range names {
-		if err := m.ReadLogFile(filepath.Join(path, name)); err != nil {
+	return m.ReadLogFiles(paths...)
+}
+
+// ReadLogFiles : pathsに指定したJSON形式のメッセージデータを全て読み込む。
+// 月毎のメッセージは全てのファイルを読み込んだ後に一度だけ並べ替える。
+func (m *MessageTable) ReadLogFiles(paths ...string) error {
+	keys := map[MessageMonthKey]struct{}{}
+	for _, path := range paths {
+		key, ok, err := m.readLogFile(path)
+		if err != nil {
 			return err
 		}
+		if ok {
+			keys[key] = struct{}{}
+		}
+	}
+	for key := range keys {
+		m.sortMonth(key)
 	}
 	return nil
 }
@@ -65,83 +78,99 @@ var reMsgFilename = regexp.MustCompile(`^(\d{4})-(\d{2})-\d{2}\.json$`)
 // ReadLogFile : pathに指定したJSON形式のメッセージデータを読み込む。
 // すでにそのファイルが読み込み済みの場合は処理をスキップする。
 func (m *MessageTable) ReadLogFile(path string) error {
-	path, err := filepath.Abs(path)
+	key, ok, err := m.readLogFile(path)
 	if err != nil {
 		return err
 	}
+	if ok {
+		m.sortMonth(key)
+	}
+	return nil
+}
+
+// readLogFile : ReadLogFile()と同じくpathのメッセージデータを読み込むが、その
+// 月のメッセージを並べ替えない。メッセージを追加した場合はその月を返す。
+func (m *MessageTable) readLogFile(path string) (MessageMonthKey, bool, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return MessageMonthKey{}, false, err
+	}
 	if _, ok := m.loadedFiles[path]; ok {
-		return nil
+		return MessageMonthKey{}, false, nil
 	}
 
 	match := reMsgFilename.FindStringSubmatch(filepath.Base(path))
 	if len(match) == 0 {
-		fmt.Fprintf(os.Stderr, "[warning] skipping %s ...\n", path)
-		return nil
+		slog.Warn("skipping a file not named YYYY-MM-DD.json", "path", path)
+		return MessageMonthKey{}, false, nil
 	}
 
 	var msgs []Message
-	var visibleMsgs []Message
 	err = ReadFileAsJSON(path, &msgs)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal %s: %w", path, err)
+		return MessageMonthKey{}, false, fmt.Errorf("failed to unmarshal %s: %w", path, err)
 	}
-	for i, msg := range msgs {
+
+	key, err := NewMessageMonthKey(match[1], match[2])
+	if err != nil {
+		return MessageMonthKey{}, false, err
+	}
+	m.appendMessages(key, msgs)
+
+	// loaded marker
+	m.loadedFiles[path] = struct{}{}
+	return key, true, nil
+}
+
+// AddMessages : keyの月に投稿されたメッセージとしてmsgsを追加する。
+// スレッドへの返信はThreadMapにも登録する。
+func (m *MessageTable) AddMessages(key MessageMonthKey, msgs []Message) {
+	m.appendMessages(key, msgs)
+	m.sortMonth(key)
+}
+
+// appendMessages : AddMessages()と同じくmsgsを追加するが、その月のメッセージ
+// を並べ替えない。追加し終えたらsortMonth()を呼ぶ必要がある。
+func (m *MessageTable) appendMessages(key MessageMonthKey, msgs []Message) {
+	var visibleMsgs []Message
+	for _, msg := range msgs {
 		if !msg.IsVisible() {
 			continue
 		}
 		threadTs := msg.ThreadTs
-		if threadTs == "" || msg.IsRootOfThread() ||
-			msg.Subtype == "thread_broadcast" ||
-			msg.Subtype == "bot_message" ||
-			msg.Subtype == "slackbot_response" {
+		if msg.IsShownInChannel() {
 			visibleMsgs = append(visibleMsgs, msg)
 		}
 		if threadTs != "" {
 			if m.ThreadMap[threadTs] == nil {
-				m.ThreadMap[threadTs] = &Thread{}
-			}
-			if msg.IsRootOfThread() {
-				m.ThreadMap[threadTs].rootMsg = &msgs[i]
-			} else {
-				if m.ThreadMap[threadTs].replies == nil {
-					m.ThreadMap[threadTs].replies = []Message{msg}
-				} else {
-					m.ThreadMap[threadTs].replies = append(m.ThreadMap[threadTs].replies, msg)
-				}
+				m.ThreadMap[threadTs] = newThread(threadTs)
 			}
+			m.ThreadMap[threadTs].add(key, msg)
 		}
 	}
 
-	key, err := NewMessageMonthKey(match[1], match[2])
-	if err != nil {
-		return err
-	}
-	if len(visibleMsgs) != 0 {
-		if _, ok := m.MsgsMap[key]; !ok {
-			m.MsgsMap[key] = visibleMsgs
-		} else {
-			m.MsgsMap[key] = append(m.MsgsMap[key], visibleMsgs...)
-		}
+	if len(visibleMsgs) == 0 {
+		return
 	}
+	m.MsgsMap[key] = append(m.MsgsMap[key], visibleMsgs...)
+}
 
-	for key, msgs := range m.MsgsMap {
-		sort.SliceStable(m.MsgsMap[key], func(i, j int) bool {
-			// must be the same digits, so no need to convert the timestamp to a number
-			return m.MsgsMap[key][i].Ts < m.MsgsMap[key][j].Ts
-		})
-		var lastUser string
-		for i, msg := range msgs {
-			if lastUser == msg.User {
-				(&msgs[i]).Trail = true
-			} else {
-				lastUser = msg.User
-			}
-		}
+// sortMonth : keyの月のメッセージを投稿時刻順に並べ、Trailを設定し直す。
+func (m *MessageTable) sortMonth(key MessageMonthKey) {
+	if msgs, ok := m.MsgsMap[key]; ok {
+		sortMessages(msgs)
+		markTrail(msgs)
 	}
+}
 
-	// loaded marker
-	m.loadedFiles[path] = struct{}{}
-	return nil
+// markTrail : 投稿時刻順に並んだmsgsについて、直前のメッセージと投稿者が同じも
+// のにTrailを設定する。
+func markTrail(msgs []Message) {
+	var lastUser string
+	for i, msg := range msgs {
+		msgs[i].Trail = lastUser == msg.User
+		lastUser = msg.User
+	}
 }
 
 type MessageMonthKey struct {
@@ -161,6 +190,22 @@ func NewMessageMonthKey(year, month string) (MessageMonthKey, error) {
 	return MessageMonthKey{year: y, month: m}, nil
 }
 
+// monthKeyOfTs : tsのメッセージが投稿された月を返す。
+// convert-exported-logsと同じタイムゾーンで判定するため、メッセージファイルの
+// 年月と一致する。
+func monthKeyOfTs(ts string) MessageMonthKey {
+	t := TsToDateTime(ts)
+	return MessageMonthKey{year: t.Year(), month: int(t.Month())}
+}
+
+// before : kがoより前の月であるかを返す。
+func (k MessageMonthKey) before(o MessageMonthKey) bool {
+	if k.year != o.year {
+		return k.year < o.year
+	}
+	return k.month < o.month
+}
+
 func (k MessageMonthKey) Next() MessageMonthKey {
 	if k.month >= 12 {
 		return MessageMonthKey{year: k.year + 1, month: 1}
@@ -225,6 +270,7 @@ type Message struct {
 	ParentUserID string              `json:"parent_user_id,omitempty"`
 	Username     string              `json:"username,omitempty"`
 	BotID        string              `json:"bot_id,omitempty"`
+	BotProfile   *MessageBotProfile  `json:"bot_profile,omitempty"`
 	Team         string              `json:"team,omitempty"`
 	UserTeam     string              `json:"user_team,omitempty"`
 	SourceTeam   string              `json:"source_team,omitempty"`
@@ -251,6 +297,23 @@ func (m Message) IsVisible() bool {
 		m.Subtype == "thread_broadcast"
 }
 
+// IsShownInChannel : メッセージをチャンネルの月毎のページに並べるべきかを判定す
+// る。
+// スレッドへの返信はスレッド内にのみ表示するが、チャンネルにも投稿された返信やボッ
+// トのメッセージはチャンネル側にも表示する。
+func (m Message) IsShownInChannel() bool {
+	return m.ThreadTs == "" || m.IsRootOfThread() ||
+		m.Subtype == "thread_broadcast" ||
+		m.Subtype == "bot_message" ||
+		m.Subtype == "slackbot_response"
+}
+
+// IsBotMessage : ボットやSlackbotの投稿であり、投稿者をUserではなく
+// ResolveBotIdentity()で解決すべきメッセージかを判定する。
+func (m Message) IsBotMessage() bool {
+	return m.Subtype == "bot_message" || m.Subtype == "slackbot_response"
+}
+
 // IsRootOfThread : メッセージがスレッドの最初のメッセージであるかを判定する。
 func (m Message) IsRootOfThread() bool {
 	return m.Ts == m.ThreadTs
@@ -335,11 +398,21 @@ type MessageFile struct {
 	OriginalW          int64  `json:"original_w,omitempty"`
 	OriginalH          int64  `json:"original_h,omitempty"`
 	ThumbVideo         string `json:"thumb_video,omitempty"`
+	ThumbPDF           string `json:"thumb_pdf,omitempty"`
+	ThumbPDFW          int64  `json:"thumb_pdf_w,omitempty"`
+	ThumbPDFH          int64  `json:"thumb_pdf_h,omitempty"`
 	Permalink          string `json:"permalink"`
 	PermalinkPublic    string `json:"permalink_public"`
 	EditLink           string `json:"edit_link,omitempty"`
 	IsStarred          bool   `json:"is_starred"`
 	HasRichPreview     bool   `json:"has_rich_preview"`
+	// スニペット(mode: snippet)の先頭部分と行数
+	Preview            string `json:"preview,omitempty"`
+	PreviewIsTruncated bool   `json:"preview_is_truncated,omitempty"`
+	Lines              int    `json:"lines,omitempty"`
+	LinesMore          int    `json:"lines_more,omitempty"`
+	// ポストやキャンバスの内容。エクスポートに含まれている場合のみ
+	SimplifiedHTML string `json:"simplified_html,omitempty"`
 }
 
 func (f *MessageFile) TopLevelMimetype() string {
@@ -350,15 +423,19 @@ func (f *MessageFile) TopLevelMimetype() string {
 	return f.Mimetype[:i]
 }
 
+// LocalFilePath : download-filesでfilesDirにダウンロードした元のファイルのパス
+// を返す。
+func (f *MessageFile) LocalFilePath(filesDir string) string {
+	return filepath.Join(filesDir, f.ID, f.downloadFilenameOf(f.URLPrivate))
+}
+
 func (f *MessageFile) OriginalFilePath() string {
-	suffix := f.DownloadURLsAndSuffixes()[f.URLPrivate]
-	return f.ID + "/" + url.PathEscape(f.DownloadFilename(f.URLPrivate, suffix))
+	return f.ID + "/" + url.PathEscape(f.downloadFilenameOf(f.URLPrivate))
 }
 
 func (f *MessageFile) ThumbImagePath() string {
 	if f.Thumb1024 != "" {
-		suffix := f.DownloadURLsAndSuffixes()[f.Thumb1024]
-		return f.ID + "/" + url.PathEscape(f.DownloadFilename(f.Thumb1024, suffix))
+		return f.ID + "/" + url.PathEscape(f.downloadFilenameOf(f.Thumb1024))
 	}
 	return f.OriginalFilePath()
 }
@@ -378,27 +455,95 @@ func (f *MessageFile) ThumbImageHeight() int64 {
 }
 
 func (f *MessageFile) ThumbVideoPath() string {
-	suffix := f.DownloadURLsAndSuffixes()[f.ThumbVideo]
-	return f.ID + "/" + url.PathEscape(f.DownloadFilename(f.ThumbVideo, suffix))
+	return f.ID + "/" + url.PathEscape(f.downloadFilenameOf(f.ThumbVideo))
 }
 
-func (f *MessageFile) DownloadURLsAndSuffixes() map[string]string {
-	return map[string]string{
-		f.URLPrivate:   "",
-		f.Thumb64:      "_64",
-		f.Thumb80:      "_80",
-		f.Thumb160:     "_160",
-		f.Thumb360:     "_360",
-		f.Thumb480:     "_480",
-		f.Thumb720:     "_720",
-		f.Thumb800:     "_800",
-		f.Thumb960:     "_960",
-		f.Thumb1024:    "_1024",
-		f.Thumb360Gif:  "_360",
-		f.Thumb480Gif:  "_480",
-		f.DeanimateGif: "_deanimate_gif",
-		f.ThumbVideo:   "_thumb_video",
+// IsPDF : PDFファイルであるかを判定する。
+func (f *MessageFile) IsPDF() bool {
+	return f.Mimetype == "application/pdf" || f.Filetype == "pdf"
+}
+
+// IsText : プレーンテキストのファイルであるかを判定する。
+// コードのファイルはsnippetLexer()で判定する。
+func (f *MessageFile) IsText() bool {
+	return f.Filetype == "text" || f.Mimetype == "text/plain" && snippetLexer(f) == nil
+}
+
+// PDFPreviewPath : PDFの最初のページのプレビュー画像のパスを返す。
+// Slackが生成したthumb_pdfがあればそれを、なければdownload-filesがpdftoppmで生
+// 成する画像のパスを返す。
+func (f *MessageFile) PDFPreviewPath() string {
+	if f.ThumbPDF != "" {
+		return f.ID + "/" + url.PathEscape(f.downloadFilenameOf(f.ThumbPDF))
 	}
+	return f.ID + "/" + url.PathEscape(f.PDFPreviewFilename())
+}
+
+// PDFPreviewFilename : download-filesがpdftoppmで生成するプレビュー画像のファイ
+// ル名を返す。元のファイル名から拡張子を除いたものに_pdf_preview.pngを付ける。
+func (f *MessageFile) PDFPreviewFilename() string {
+	name := strings.TrimSuffix(f.Name, filepath.Ext(f.Name))
+	filename := filenameReplacer.Replace(name + "_pdf_preview.png")
+	// XXX: Jekyll doesn't publish files that name starts with some characters
+	if strings.HasPrefix(filename, "_") || strings.HasPrefix(filename, ".") {
+		filename = "files" + filename
+	}
+	return filename
+}
+
+// DownloadURL : download-filesでダウンロードするファイルのURLと、保存するファイ
+// ル名に付ける接尾辞。
+type DownloadURL struct {
+	URL    string
+	Suffix string
+}
+
+// DownloadURLsAndSuffixes : ダウンロードする元のファイルとサムネイルなどのURL
+// と接尾辞を返す。
+// URLが空のもの(ファイルにないサイズのサムネイルなど)は含まない。同じURLが複数
+// の項目にあれば最初のもののみを返す。
+func (f *MessageFile) DownloadURLsAndSuffixes() []DownloadURL {
+	all := []DownloadURL{
+		{f.URLPrivate, ""},
+		{f.Thumb64, "_64"},
+		{f.Thumb80, "_80"},
+		{f.Thumb160, "_160"},
+		{f.Thumb360, "_360"},
+		{f.Thumb480, "_480"},
+		{f.Thumb720, "_720"},
+		{f.Thumb800, "_800"},
+		{f.Thumb960, "_960"},
+		{f.Thumb1024, "_1024"},
+		{f.Thumb360Gif, "_360"},
+		{f.Thumb480Gif, "_480"},
+		{f.DeanimateGif, "_deanimate_gif"},
+		{f.ThumbVideo, "_thumb_video"},
+		{f.ThumbPDF, "_thumb_pdf"},
+	}
+	urls := make([]DownloadURL, 0, len(all))
+	seen := make(map[string]struct{}, len(all))
+	for _, d := range all {
+		if d.URL == "" {
+			continue
+		}
+		if _, ok := seen[d.URL]; ok {
+			continue
+		}
+		seen[d.URL] = struct{}{}
+		urls = append(urls, d)
+	}
+	return urls
+}
+
+// downloadFilenameOf : DownloadURLsAndSuffixes()のURLであるuをダウンロードした
+// ファイルの名前を返す。
+func (f *MessageFile) downloadFilenameOf(u string) string {
+	for _, d := range f.DownloadURLsAndSuffixes() {
+		if d.URL == u {
+			return f.DownloadFilename(d.URL, d.Suffix)
+		}
+	}
+	return f.DownloadFilename(u, "")
 }
 
 var filenameReplacer = strings.NewReplacer(
@@ -435,7 +580,20 @@ func (f *MessageFile) DownloadFilename(url, suffix string) string {
 }
 
 type MessageIcons struct {
+	Image36 string `json:"image_36,omitempty"`
 	Image48 string `json:"image_48"`
+	Image72 string `json:"image_72,omitempty"`
+}
+
+// MessageBotProfile : ボット・アプリの投稿に付与される、投稿時点のボットの情報。
+type MessageBotProfile struct {
+	ID      string        `json:"id"`
+	AppID   string        `json:"app_id,omitempty"`
+	Name    string        `json:"name"`
+	Icons   *MessageIcons `json:"icons,omitempty"`
+	Deleted bool          `json:"deleted,omitempty"`
+	Updated int64         `json:"updated,omitempty"`
+	TeamID  string        `json:"team_id,omitempty"`
 }
 
 type MessageEdited struct {
@@ -467,27 +625,90 @@ type MessageBlockElement struct {
 	ChannelID string `json:"channel_id"` // for type = "channel"
 }
 
+// MessageAttachment : メッセージの添付(レガシーなattachments)。
+// URLの展開(unfurl)やボット・アプリの投稿に用いられる。
+// https://api.slack.com/reference/messaging/attachments
 type MessageAttachment struct {
-	ServiceName     string `json:"service_name,omitempty"`
-	AuthorIcon      string `json:"author_icon,omitempty"`
-	AuthorName      string `json:"author_name,omitempty"`
-	AuthorSubname   string `json:"author_subname,omitempty"`
-	Title           string `json:"title,omitempty"`
-	TitleLink       string `json:"title_link,omitempty"`
-	Text            string `json:"text,omitempty"`
-	Fallback        string `json:"fallback,omitempty"`
-	ThumbURL        string `json:"thumb_url,omitempty"`
-	FromURL         string `json:"from_url,omitempty"`
-	ThumbWidth      int    `json:"thumb_width,omitempty"`
-	ThumbHeight     int    `json:"thumb_height,omitempty"`
-	ServiceIcon     string `json:"service_icon,omitempty"`
-	ID              int    `json:"id"`
-	OriginalURL     string `json:"original_url,omitempty"`
-	VideoHTML       string `json:"video_html,omitempty"`
-	VideoHTMLWidth  int    `json:"video_html_width,omitempty"`
-	VideoHTMLHeight int    `json:"video_html_height,omitempty"`
-	Footer          string `json:"footer,omitempty"`
-	FooterIcon      string `json:"footer_icon,omitempty"`
+	ServiceName     string                    `json:"service_name,omitempty"`
+	AuthorIcon      string                    `json:"author_icon,omitempty"`
+	AuthorName      string                    `json:"author_name,omitempty"`
+	AuthorSubname   string                    `json:"author_subname,omitempty"`
+	AuthorLink      string                    `json:"author_link,omitempty"`
+	Color           string                    `json:"color,omitempty"`
+	Pretext         string                    `json:"pretext,omitempty"`
+	Title           string                    `json:"title,omitempty"`
+	TitleLink       string                    `json:"title_link,omitempty"`
+	Text            string                    `json:"text,omitempty"`
+	Fallback        string                    `json:"fallback,omitempty"`
+	Fields          []MessageAttachmentField  `json:"fields,omitempty"`
+	Actions         []MessageAttachmentAction `json:"actions,omitempty"`
+	ImageURL        string                    `json:"image_url,omitempty"`
+	ImageWidth      int                       `json:"image_width,omitempty"`
+	ImageHeight     int                       `json:"image_height,omitempty"`
+	ThumbURL        string                    `json:"thumb_url,omitempty"`
+	FromURL         string                    `json:"from_url,omitempty"`
+	ThumbWidth      int                       `json:"thumb_width,omitempty"`
+	ThumbHeight     int                       `json:"thumb_height,omitempty"`
+	ServiceIcon     string                    `json:"service_icon,omitempty"`
+	ID              int                       `json:"id"`
+	OriginalURL     string                    `json:"original_url,omitempty"`
+	VideoHTML       string                    `json:"video_html,omitempty"`
+	VideoHTMLWidth  int                       `json:"video_html_width,omitempty"`
+	VideoHTMLHeight int                       `json:"video_html_height,omitempty"`
+	Footer          string                    `json:"footer,omitempty"`
+	FooterIcon      string                    `json:"footer_icon,omitempty"`
+	Ts              AttachmentTs              `json:"ts,omitempty"`
+	MrkdwnIn        []string                  `json:"mrkdwn_in,omitempty"`
+}
+
+// MessageAttachmentField : 添付の表形式の項目。
+// Shortがtrueの項目は他の項目と横に並べて表示できる。
+type MessageAttachmentField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// MessageAttachmentAction : 添付のボタンやメニュー。
+// アーカイブでは操作できないため、URLを持つボタンのみをリンクとして表示する。
+type MessageAttachmentAction struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Text  string `json:"text"`
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+	Style string `json:"style,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// AttachmentTs : 添付のフッターに表示する時刻(UNIX時間の秒)。
+// 数値と文字列のどちらで書かれていても読み込めるようにしている。
+type AttachmentTs string
+
+func (ts *AttachmentTs) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*ts = AttachmentTs(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("invalid attachment ts: %s", b)
+	}
+	*ts = AttachmentTs(n.String())
+	return nil
+}
+
+// Time : 時刻を返す。空の場合はゼロ値を返す。
+func (ts AttachmentTs) Time() time.Time {
+	if ts == "" {
+		return time.Time{}
+	}
+	s := string(ts)
+	if !strings.Contains(s, ".") {
+		s += ".000000"
+	}
+	return TsToDateTime(s)
 }
 
 type MessageReaction struct {
@@ -0,0 +1,48 @@
+package slacklog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMessageFile_PDFPreviewFilename(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report_pdf_preview.png"},
+		{"a.b", "a_pdf_preview.png"},
+		{"x.md", "x_pdf_preview.png"},
+		{"README", "README_pdf_preview.png"},
+		{"a", "a_pdf_preview.png"},
+		{"", "files_pdf_preview.png"},
+		{".pdf", "files_pdf_preview.png"},
+		{"archive.tar.pdf", "archive.tar_pdf_preview.png"},
+		{"a:b?.pdf", "a_b__pdf_preview.png"},
+	} {
+		f := &MessageFile{Name: tc.name}
+		if got := f.PDFPreviewFilename(); got != tc.want {
+			t.Errorf("PDFPreviewFilename() for %q = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMessageFile_DownloadURLsAndSuffixes(t *testing.T) {
+	// a PDF without url_private and most of the thumbnails.
+	f := &MessageFile{
+		ID:       "F1",
+		Name:     "report.pdf",
+		Thumb64:  "https://files.slack.com/F1/report_64.png",
+		ThumbPDF: "https://files.slack.com/F1/report_thumb_pdf.png",
+	}
+	want := []DownloadURL{
+		{"https://files.slack.com/F1/report_64.png", "_64"},
+		{"https://files.slack.com/F1/report_thumb_pdf.png", "_thumb_pdf"},
+	}
+	if got := f.DownloadURLsAndSuffixes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DownloadURLsAndSuffixes() = %v, want %v", got, want)
+	}
+	if got, want := f.PDFPreviewPath(), "F1/report_thumb_pdf.png"; got != want {
+		t.Errorf("PDFPreviewPath() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,234 @@
+package slacklog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// tsMapFilename : 複数のページに分けた月の、メッセージとページの対応を書き出す
+// ファイルの名前
+const tsMapFilename = "ts.json"
+
+// MonthPage : 月毎のページを複数に分けた場合の、そのうちの一ページ。
+// 分けない場合や日毎のページはNum, Totalとも1となる。
+type MonthPage struct {
+	Num   int
+	Total int
+	// ページのチャンネルのIDと月
+	channelID string
+	key       MessageMonthKey
+	// 月の最初のページのURL
+	base string
+	// 月のメッセージ(スレッドへの返信を含む)があるページの、baseからの相対URL
+	// key: ts
+	pageOf map[string]string
+	// このページに表示するメッセージ。withMessages()で設定する。
+	// key: ts
+	local map[string]struct{}
+	// 前の月のページ数。前の月がなければ0
+	prevTotal int
+}
+
+// withMessages : msgsを表示するページとしてpのコピーを返す。
+func (p *MonthPage) withMessages(msgs []Message) *MonthPage {
+	page := *p
+	page.local = make(map[string]struct{}, len(msgs))
+	for _, msg := range msgs {
+		page.local[msg.Ts] = struct{}{}
+	}
+	return &page
+}
+
+// PageLink : ページ番号のリンク。
+type PageLink struct {
+	Num     int
+	URL     string
+	Current bool
+}
+
+// URLOf : n番目のページのURLを返す。
+func (p *MonthPage) URLOf(n int) string {
+	return p.base + pageSuffix(n)
+}
+
+func (p *MonthPage) HasPrev() bool {
+	return p.Num > 1
+}
+
+func (p *MonthPage) HasNext() bool {
+	return p.Num < p.Total
+}
+
+func (p *MonthPage) PrevURL() string {
+	return p.URLOf(p.Num - 1)
+}
+
+func (p *MonthPage) NextURL() string {
+	return p.URLOf(p.Num + 1)
+}
+
+// PrevMonthURL : 前の月の最後のページのURLを返す。
+func (p *MonthPage) PrevMonthURL() string {
+	return monthURL(p.channelID, p.key.Prev()) + pageSuffix(p.prevTotal)
+}
+
+// Links : 全てのページへのリンクを返す。
+func (p *MonthPage) Links() []PageLink {
+	links := make([]PageLink, p.Total)
+	for i := range links {
+		links[i] = PageLink{Num: i + 1, URL: p.URLOf(i + 1), Current: i+1 == p.Num}
+	}
+	return links
+}
+
+// monthURL : チャンネルのkeyの月の最初のページのURLを返す。
+func monthURL(channelID string, key MessageMonthKey) string {
+	return fmt.Sprintf("{{ site.baseurl }}/%s/%s/%s/", channelID, key.Year(), key.Month())
+}
+
+// pageSuffix : n番目のページの、月の最初のページからの相対URLを返す。
+func pageSuffix(n int) string {
+	if n <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("page/%d/", n)
+}
+
+// pageCount : チャンネルに表示するメッセージがn件の月を、perPage件毎に分けた
+// ページの数を返す。paginate()の分け方と一致する。
+func pageCount(n, perPage int) int {
+	if perPage <= 0 || n <= perPage {
+		return 1
+	}
+	return (n + perPage - 1) / perPage
+}
+
+// countPages : 全てのチャンネルの月毎のページ数を数える。
+// 月の最初のページから前の月の最後のページへリンクするため、ページを生成する前
+// に全ての月のメッセージを読み込んで数える。
+// Config.MessagesPerPageが0以下の場合は全ての月が1ページとなるためnilを返す。
+// key: channel ID, month, value: ページ数
+func (g *HTMLGenerator) countPages(ctx context.Context) (map[string]map[MessageMonthKey]int, error) {
+	perPage := g.cfg.MessagesPerPage
+	if perPage <= 0 {
+		return nil, nil
+	}
+	channels := g.s.GetChannels()
+	counts := make([]map[MessageMonthKey]int, len(channels))
+	indices := make([]int, len(channels))
+	for i := range indices {
+		indices[i] = i
+	}
+	err := runParallel(ctx, g.workers, indices, func(ctx context.Context, i int) error {
+		channelID := channels[i].ID
+		keys, err := g.s.GetMonthKeys(channelID)
+		if err != nil {
+			return fmt.Errorf("failed to count pages of channel %s: %w", channelID, err)
+		}
+		counts[i] = make(map[MessageMonthKey]int, len(keys))
+		for _, key := range keys {
+			msgs, err := g.s.GetMessagesOfMonth(channelID, key)
+			if err != nil {
+				return fmt.Errorf("failed to count pages of channel %s: %w", channelID, err)
+			}
+			n := 0
+			for _, msg := range msgs {
+				if g.isVisibleMessage(msg) {
+					n++
+				}
+			}
+			g.s.ReleaseMonth(channelID, key)
+			counts[i][key] = pageCount(n, perPage)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	pages := make(map[string]map[MessageMonthKey]int, len(channels))
+	for i, ch := range channels {
+		pages[ch.ID] = counts[i]
+	}
+	return pages, nil
+}
+
+// paginate : msgsをチャンネルに表示するメッセージperPage件毎のページに分ける。
+// スレッドへの返信は先頭のメッセージと同じページに表示するため数えない。
+// perPageが0以下の場合は分けない。
+// 返す各MonthPageはメッセージとページの対応を共有する。
+func (g *HTMLGenerator) paginate(channel Channel, key MessageMonthKey, msgs []Message, perPage int) ([]*MonthPage, [][]Message) {
+	var chunks [][]Message
+	start, n := 0, 0
+	for i, msg := range msgs {
+		if !g.isVisibleMessage(msg) {
+			continue
+		}
+		if perPage > 0 && n == perPage {
+			chunks = append(chunks, msgs[start:i])
+			start, n = i, 0
+		}
+		n++
+	}
+	chunks = append(chunks, msgs[start:])
+
+	base := monthURL(channel.ID, key)
+	pageOf := map[string]string{}
+	pages := make([]*MonthPage, len(chunks))
+	for i, chunk := range chunks {
+		pages[i] = &MonthPage{Num: i + 1, Total: len(chunks), channelID: channel.ID, key: key, base: base, pageOf: pageOf, prevTotal: g.pageCounts[channel.ID][key.Prev()]}
+		suffix := pageSuffix(i + 1)
+		for _, msg := range chunk {
+			pageOf[msg.Ts] = suffix
+			if !msg.IsRootOfThread() {
+				continue
+			}
+			if t, ok := g.s.GetThread(channel.ID, msg.Ts); ok {
+				for _, reply := range t.Replies() {
+					if _, ok := pageOf[reply.Ts]; !ok {
+						pageOf[reply.Ts] = suffix
+					}
+				}
+			}
+		}
+	}
+	return pages, chunks
+}
+
+// writeTsMap : メッセージとページの対応をpath/ts.jsonに書き出す。
+// 他のページや月の最初のページへの#ts-のリンクは、これを用いてメッセージのある
+// ページに転送される(site/assets/javascripts/slacklog.js)。
+func (p *MonthPage) writeTsMap(path string) error {
+	f, err := os.Create(filepath.Join(path, tsMapFilename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(p.pageOf); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tsMapFilename, err)
+	}
+	return nil
+}
+
+// TsLink : tsのメッセージへのリンクを返す。
+// このページにない他のページのメッセージであれば、そのページへのURLを返す。
+func (p *MonthPage) TsLink(ts string) string {
+	if _, ok := p.local[ts]; ok {
+		return "#ts-" + ts
+	}
+	if suffix, ok := p.pageOf[ts]; ok {
+		return p.base + suffix + "#ts-" + ts
+	}
+	return "#ts-" + ts
+}
+
+// RootLink : スレッドtの先頭メッセージへのリンクを返す。
+// 先頭メッセージが前の月にあれば、その月のページへのURLを返す。
+func (p *MonthPage) RootLink(t *Thread) string {
+	if key := t.RootMonth(); key != p.key {
+		return monthURL(p.channelID, key) + "#ts-" + t.Ts()
+	}
+	return p.TsLink(t.Ts())
+}
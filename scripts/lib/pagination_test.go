@@ -0,0 +1,63 @@
+package slacklog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPrevMonthLink : 分割した月の次の月の最初のページから、前の月の最後のペー
+// ジへリンクすることを確かめる。
+func TestPrevMonthLink(t *testing.T) {
+	if err := SetTimezone(""); err != nil {
+		t.Fatal(err)
+	}
+	s := NewMemoryLogStore()
+	s.AddUsers(User{ID: "U1", Name: "alice"})
+	s.AddChannels(Channel{ID: "C1", Name: "general"})
+	// five messages in 2020-01 and one in 2020-02 (Asia/Tokyo)
+	var msgs []Message
+	for i := 0; i < 5; i++ {
+		msgs = append(msgs, Message{User: "U1", Text: "january", Ts: fmt.Sprintf("%d.000100", 1577836800+i*3600)})
+	}
+	msgs = append(msgs, Message{User: "U1", Text: "february", Ts: "1580860800.000100"})
+	if err := s.AddMessages("C1", msgs...); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.MessagesPerPage = 2
+	outDir := t.TempDir()
+	if err := NewHTMLGenerator("", s, cfg).Generate(context.Background(), outDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "C1", "2020", "01", "page", "3", "index.html")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, "C1", "2020", "02", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<a class='slacklog-prev-month' href='{{ site.baseurl }}/C1/2020/01/page/3/'>"
+	if !strings.Contains(string(b), want) {
+		t.Errorf("the first page of 2020-02 does not link to the last page of 2020-01: want %s", want)
+	}
+}
+
+func TestPageCount(t *testing.T) {
+	for _, tc := range []struct {
+		n, perPage, want int
+	}{
+		{0, 2, 1},
+		{2, 2, 1},
+		{3, 2, 2},
+		{5, 2, 3},
+		{100, 0, 1},
+	} {
+		if got := pageCount(tc.n, tc.perPage); got != tc.want {
+			t.Errorf("pageCount(%d, %d) = %d, want %d", tc.n, tc.perPage, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package slacklog
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// runParallel : tasksの各要素に対してfnを最大n個のgoroutineで並列に実行する。
+// ctxがキャンセルされた場合、未着手のタスクは実行せずにctx.Err()を返す。
+// 失敗した全てのタスクのエラーをerrors.Join()でまとめて返す。
+func runParallel[T any](ctx context.Context, n int, tasks []T, fn func(ctx context.Context, task T) error) error {
+	if n < 1 {
+		n = 1
+	}
+	ch := make(chan T)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range ch {
+				if err := fn(ctx, task); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	canceled := false
+send:
+	for _, task := range tasks {
+		select {
+		case ch <- task:
+		case <-ctx.Done():
+			canceled = true
+			break send
+		}
+	}
+	close(ch)
+	wg.Wait()
+	if canceled {
+		errs = append(errs, ctx.Err())
+	}
+	return errors.Join(errs...)
+}
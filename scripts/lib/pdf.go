@@ -0,0 +1,29 @@
+package slacklog
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNoPDFRenderer : PDFのプレビュー画像の生成に必要なpdftoppmがない。
+var ErrNoPDFRenderer = errors.New("pdftoppm not found")
+
+// GeneratePDFPreview : pdfPathのPDFの最初のページをPNG画像としてpngPathに書き出
+// す。
+// 画像の生成にはpopplerのpdftoppmを用いる。見つからない場合はErrNoPDFRenderer
+// を返す。
+func GeneratePDFPreview(pdfPath, pngPath string) error {
+	bin, err := exec.LookPath("pdftoppm")
+	if err != nil {
+		return ErrNoPDFRenderer
+	}
+	// with -singlefile, pdftoppm writes to "${root}.png".
+	root := strings.TrimSuffix(pngPath, ".png")
+	cmd := exec.Command(bin, "-png", "-f", "1", "-l", "1", "-singlefile", "-scale-to", "1024", pdfPath, root)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pdftoppm failed for %s: %w: %s", pdfPath, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
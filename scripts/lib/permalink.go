@@ -0,0 +1,197 @@
+package slacklog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// permalinkMapFilename : 検索ページが参照する、投稿した月と異なる月のページに表
+// 示するメッセージの一覧を書き出すファイルの名前
+const permalinkMapFilename = "months.json"
+
+var reHref = regexp.MustCompile(`href=(?:'[^']*'|"[^"]*")`)
+
+// permalinkIndex : Slackのメッセージへのリンクを、アーカイブのそのメッセージを
+// 表示するページへのリンクに置き換えるための索引。
+type permalinkIndex struct {
+	// Slackのメッセージへのリンク。permalinkRegexp()で作る。
+	re *regexp.Regexp
+	// リンクを含み得るHTMLかを調べるための、リンクの一部の文字列
+	hint string
+	// key: channel ID, ts, value: そのメッセージを表示する月
+	months map[string]map[string]MessageMonthKey
+}
+
+// permalinkRegexp : cfgのワークスペースのメッセージへのリンクにマッチする正規
+// 表現を返す。リンクはConfig.PermalinkFormatの書式で、ドメインが設定されていな
+// ければ*.slack.comのいずれかとする。
+// スレッドへの返信には?thread_ts=...&cid=...が付く。
+// マッチした部分のchannel、sec、usecがチャンネルIDとtsの整数部と小数部になる。
+func permalinkRegexp(cfg *Config) *regexp.Regexp {
+	format := cfg.PermalinkFormat
+	if format == "" {
+		format = DefaultPermalinkFormat
+	}
+	domain := `[a-z0-9-]+\.slack\.com`
+	if cfg.WorkspaceDomain != "" {
+		domain = regexp.QuoteMeta(cfg.WorkspaceDomain)
+	}
+	pattern := strings.NewReplacer(
+		`\{domain\}`, domain,
+		`\{channel\}`, `(?P<channel>[A-Z0-9]+)`,
+		`\{ts\}`, `(?P<sec>\d{10})(?P<usec>\d{6})`,
+	).Replace(regexp.QuoteMeta(format))
+	return regexp.MustCompile(`^` + pattern + `(?:\?\S*)?$`)
+}
+
+// permalinkHint : formatの{channel}の直前の、置き換えられない部分を返す。
+// 既定の書式では"/archives/"となる。
+func permalinkHint(format string) string {
+	if format == "" {
+		format = DefaultPermalinkFormat
+	}
+	i := strings.Index(format, "{channel}")
+	if i < 0 {
+		return ""
+	}
+	hint := format[:i]
+	if j := strings.LastIndex(hint, "}"); j >= 0 {
+		hint = hint[j+1:]
+	}
+	return hint
+}
+
+// newPermalinkIndex : sの全てのチャンネルのメッセージから、cfgのワークスペース
+// のリンクを置き換えるpermalinkIndexを作る。
+// チャンネル毎に最大workers個を並列に読み込む。
+func newPermalinkIndex(ctx context.Context, s LogStore, cfg *Config, workers int) (*permalinkIndex, error) {
+	channels := s.GetChannels()
+	months := make([]map[string]MessageMonthKey, len(channels))
+	indices := make([]int, len(channels))
+	for i := range indices {
+		indices[i] = i
+	}
+	err := runParallel(ctx, workers, indices, func(ctx context.Context, i int) error {
+		m, err := s.GetMessageMonths(channels[i].ID)
+		if err != nil {
+			return fmt.Errorf("failed to index messages of channel %s: %w", channels[i].ID, err)
+		}
+		months[i] = m
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	idx := &permalinkIndex{
+		re:     permalinkRegexp(cfg),
+		hint:   permalinkHint(cfg.PermalinkFormat),
+		months: make(map[string]map[string]MessageMonthKey, len(channels)),
+	}
+	for i, ch := range channels {
+		if len(months[i]) > 0 {
+			idx.months[ch.ID] = months[i]
+		}
+	}
+	return idx, nil
+}
+
+// archiveURL : Slackのメッセージへのリンクuが指すメッセージがアーカイブにあれば、
+// それを表示するページのURLを返す。
+func (idx *permalinkIndex) archiveURL(u string) (string, bool) {
+	if idx == nil {
+		return "", false
+	}
+	m := idx.re.FindStringSubmatch(u)
+	if m == nil {
+		return "", false
+	}
+	channelID := m[idx.re.SubexpIndex("channel")]
+	ts := m[idx.re.SubexpIndex("sec")] + "." + m[idx.re.SubexpIndex("usec")]
+	key, ok := idx.months[channelID][ts]
+	if !ok {
+		return "", false
+	}
+	return monthURL(channelID, key) + "#ts-" + ts, true
+}
+
+// rewriteURL : uがアーカイブにあるメッセージへのリンクであれば、そのページの
+// URLに置き換えて返す。そうでなければuをそのまま返す。
+func (idx *permalinkIndex) rewriteURL(u string) string {
+	if archived, ok := idx.archiveURL(u); ok {
+		return archived
+	}
+	return u
+}
+
+// rewriteLinks : HTMLのsのhref属性のうち、アーカイブにあるメッセージへのリンク
+// をそのページへのリンクに置き換える。
+func (idx *permalinkIndex) rewriteLinks(s string) string {
+	if idx == nil || len(idx.months) == 0 || !strings.Contains(s, idx.hint) {
+		return s
+	}
+	return reHref.ReplaceAllStringFunc(s, func(attr string) string {
+		// href='...' or href="..."
+		q := attr[len("href=") : len("href=")+1]
+		u := attr[len("href=")+1 : len(attr)-1]
+		if archived, ok := idx.archiveURL(u); ok {
+			return "href=" + q + archived + q
+		}
+		return attr
+	})
+}
+
+// writeMovedMonths : 投稿した月と異なる月のページに表示するメッセージの、表示す
+// る月("YYYY/MM")をpath/months.jsonに書き出す。
+// 前の月から続くスレッドへの返信がこれにあたる。その他のメッセージの月は、検
+// 索ページがtsから求める(site/assets/javascripts/slacklog.js)。
+func (idx *permalinkIndex) writeMovedMonths(path string) error {
+	moved := map[string]map[string]string{}
+	for channelID, months := range idx.months {
+		for ts, key := range months {
+			if monthKeyOfTs(ts) == key {
+				continue
+			}
+			if moved[channelID] == nil {
+				moved[channelID] = map[string]string{}
+			}
+			moved[channelID][ts] = key.Year() + "/" + key.Month()
+		}
+	}
+	f, err := os.Create(filepath.Join(path, permalinkMapFilename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(moved); err != nil {
+		return fmt.Errorf("failed to write %s: %w", permalinkMapFilename, err)
+	}
+	return nil
+}
+
+// generatePermalinkPage : Slackのメッセージへのリンクからアーカイブのページに
+// 移動するための検索ページをpathに生成する。
+func (g *HTMLGenerator) generatePermalinkPage(path string, channels []Channel) error {
+	if err := os.MkdirAll(path, 0777); err != nil {
+		return fmt.Errorf("could not create %s directory: %w", path, err)
+	}
+	if err := g.c.permalinks.writeMovedMonths(path); err != nil {
+		return err
+	}
+	ids := make([]string, len(channels))
+	for i, ch := range channels {
+		ids[i] = ch.ID
+	}
+	timezone := g.cfg.Timezone
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+	params := make(map[string]interface{})
+	params["channelIDs"] = strings.Join(ids, ",")
+	params["timezone"] = timezone
+	return g.executeAndWrite("permalink.tmpl", params, filepath.Join(path, "index.html"))
+}
@@ -0,0 +1,35 @@
+package slacklog
+
+import "testing"
+
+func TestPermalinkIndex_ArchiveURL(t *testing.T) {
+	months := map[string]map[string]MessageMonthKey{
+		"C1": {"1546300800.000100": {year: 2019, month: 1}},
+	}
+	for _, tc := range []struct {
+		name   string
+		domain string
+		format string
+		u      string
+		want   string
+	}{
+		{"workspace", "vim-jp.slack.com", "", "https://vim-jp.slack.com/archives/C1/p1546300800000100", "{{ site.baseurl }}/C1/2019/01/#ts-1546300800.000100"},
+		{"reply", "vim-jp.slack.com", "", "https://vim-jp.slack.com/archives/C1/p1546300800000100?thread_ts=1546300700.000000&cid=C1", "{{ site.baseurl }}/C1/2019/01/#ts-1546300800.000100"},
+		{"not archived", "vim-jp.slack.com", "", "https://vim-jp.slack.com/archives/C1/p1546300800000200", ""},
+		{"other workspace", "vim-jp.slack.com", "", "https://other.slack.com/archives/C1/p1546300800000100", ""},
+		{"foreign host", "vim-jp.slack.com", "", "https://vim-jp.slack.com.example.com/archives/C1/p1546300800000100", ""},
+		{"any workspace", "", "", "https://other.slack.com/archives/C1/p1546300800000100", "{{ site.baseurl }}/C1/2019/01/#ts-1546300800.000100"},
+		{"foreign host without domain", "", "", "https://example.com/archives/C1/p1546300800000100", ""},
+		{"format", "example.enterprise.slack.com", "https://{domain}/messages/{channel}/p{ts}", "https://example.enterprise.slack.com/messages/C1/p1546300800000100", "{{ site.baseurl }}/C1/2019/01/#ts-1546300800.000100"},
+		{"other format", "example.enterprise.slack.com", "https://{domain}/messages/{channel}/p{ts}", "https://example.enterprise.slack.com/archives/C1/p1546300800000100", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Config{WorkspaceDomain: tc.domain, PermalinkFormat: tc.format}
+			idx := &permalinkIndex{re: permalinkRegexp(cfg), hint: permalinkHint(tc.format), months: months}
+			got, ok := idx.archiveURL(tc.u)
+			if got != tc.want || ok != (tc.want != "") {
+				t.Errorf("archiveURL(%q) = %q, %v; want %q", tc.u, got, ok, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package slacklog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// userRecentMessagesNum : ユーザページに表示する最近の投稿の数
+const userRecentMessagesNum = 20
+
+// UserActivity : ユーザページに表示する、ユーザの投稿の集計。
+type UserActivity struct {
+	User *User
+	// スレッドへの返信を含む投稿数
+	Messages int
+	// スレッドへの返信の数
+	Replies int
+	// key: channel ID
+	Channels map[string]*UserChannelActivity
+	// 新しい順に最大userRecentMessagesNum件
+	Recent []UserMessageRef
+}
+
+// UserChannelActivity : ユーザのチャンネル毎の投稿数。
+type UserChannelActivity struct {
+	Channel  Channel
+	Messages int
+}
+
+// UserMessageRef : ユーザの投稿と、それが表示されている月毎のページ。
+// スレッドへの返信はスレッドの先頭のメッセージがあるページに表示される。
+type UserMessageRef struct {
+	Channel Channel
+	Key     MessageMonthKey
+	Msg     Message
+}
+
+// SortedChannels : 投稿数の多い順にチャンネルを返す。
+func (a *UserActivity) SortedChannels() []*UserChannelActivity {
+	list := make([]*UserChannelActivity, 0, len(a.Channels))
+	for _, c := range a.Channels {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Messages != list[j].Messages {
+			return list[i].Messages > list[j].Messages
+		}
+		return list[i].Channel.Name < list[j].Channel.Name
+	})
+	return list
+}
+
+// activityCollector : 月毎のページを生成しながらユーザ毎の投稿を集計する。
+// 複数のワーカーから同時に呼ばれるため排他制御している。
+type activityCollector struct {
+	mu sync.Mutex
+	// key: user ID
+	users map[string]*UserActivity
+}
+
+func newActivityCollector() *activityCollector {
+	return &activityCollector{users: map[string]*UserActivity{}}
+}
+
+func (c *activityCollector) add(u *User, channel Channel, key MessageMonthKey, msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, ok := c.users[u.ID]
+	if !ok {
+		a = &UserActivity{User: u, Channels: map[string]*UserChannelActivity{}}
+		c.users[u.ID] = a
+	}
+	a.Messages++
+	if msg.ThreadTs != "" && !msg.IsRootOfThread() {
+		a.Replies++
+	}
+	ca, ok := a.Channels[channel.ID]
+	if !ok {
+		ca = &UserChannelActivity{Channel: channel}
+		a.Channels[channel.ID] = ca
+	}
+	ca.Messages++
+
+	n := len(a.Recent)
+	if n >= userRecentMessagesNum && msg.Ts <= a.Recent[n-1].Msg.Ts {
+		return
+	}
+	i := sort.Search(n, func(i int) bool {
+		return a.Recent[i].Msg.Ts < msg.Ts
+	})
+	a.Recent = append(a.Recent, UserMessageRef{})
+	copy(a.Recent[i+1:], a.Recent[i:])
+	a.Recent[i] = UserMessageRef{Channel: channel, Key: key, Msg: msg}
+	if len(a.Recent) > userRecentMessagesNum {
+		a.Recent = a.Recent[:userRecentMessagesNum]
+	}
+}
+
+// sorted : 表示名順にユーザの集計を返す。
+func (c *activityCollector) sorted(nameOf func(userID string) string) []*UserActivity {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]*UserActivity, 0, len(c.users))
+	for _, a := range c.users {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ni, nj := nameOf(list[i].User.ID), nameOf(list[j].User.ID)
+		if ni != nj {
+			return ni < nj
+		}
+		return list[i].User.ID < list[j].User.ID
+	})
+	return list
+}
+
+// isRedactedUser : Config.RedactedUsersに指定されたユーザであるかを判定する。
+func (g *HTMLGenerator) isRedactedUser(userID string) bool {
+	for _, id := range g.cfg.RedactedUsers {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// userOf : ユーザページに集計すべきメッセージであれば、その投稿者を返す。
+// ボットの投稿や、ユーザが見つからない・ページを作らないユーザの投稿はnilを返す。
+func (g *HTMLGenerator) userOf(msg *Message) *User {
+	if msg.IsBotMessage() || msg.User == "" {
+		return nil
+	}
+	u, ok := g.s.GetUserByID(msg.User)
+	if !ok || u.ID != msg.User || g.isRedactedUser(u.ID) {
+		return nil
+	}
+	return u
+}
+
+// userPageURL : ユーザページのURLを返す。ユーザページがない場合は空文字列を返
+// す。
+func (g *HTMLGenerator) userPageURL(msg *Message) string {
+	u := g.userOf(msg)
+	if u == nil {
+		return ""
+	}
+	return "{{ site.baseurl }}/users/" + u.ID + "/"
+}
+
+// generateUserPages : 集計したユーザ毎のページと、その一覧ページを生成する。
+//   - path/
+//     - index.html
+//     - ${user_id}/
+//       - index.html
+func (g *HTMLGenerator) generateUserPages(path string) error {
+	users := g.activity.sorted(g.s.GetDisplayNameByUserID)
+
+	for _, a := range users {
+		dir := filepath.Join(path, a.User.ID)
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return fmt.Errorf("could not create %s directory: %w", dir, err)
+		}
+		params := map[string]interface{}{
+			"user":     a.User,
+			"activity": a,
+		}
+		if err := g.executeAndWrite("user.tmpl", params, filepath.Join(dir, "index.html")); err != nil {
+			return err
+		}
+	}
+
+	params := map[string]interface{}{
+		"users": users,
+	}
+	return g.executeAndWrite("users_index.tmpl", params, filepath.Join(path, "index.html"))
+}
@@ -0,0 +1,261 @@
+package slacklog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// progressBarInterval : 端末の進捗バーを書き直す最短の間隔
+	progressBarInterval = 100 * time.Millisecond
+	// progressLogInterval : 端末でない場合に進捗をログに出力する最短の間隔
+	progressLogInterval = 10 * time.Second
+	progressBarWidth    = 30
+)
+
+var (
+	progressMu sync.Mutex
+	// 進捗バーを書き出す端末。nilなら進捗はログに出力する。
+	progressTTY io.Writer
+)
+
+// SetProgressBar : enabledがtrueで標準エラー出力が端末であれば、進捗をログでは
+// なく進捗バーとして表示する。
+// CIなど端末でない場合や、ログをJSONで出力する場合はfalseとする。
+func SetProgressBar(enabled bool) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressTTY = nil
+	if !enabled {
+		return
+	}
+	if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		progressTTY = os.Stderr
+	}
+}
+
+// Summary : サブコマンドの実行結果の集計。
+// 各処理はSummaryFrom()で取得して件数を加える。
+type Summary struct {
+	mu      sync.Mutex
+	Command string
+	// "ok"または"failed"
+	Status   string
+	Duration time.Duration
+	keys     []string
+	counts   map[string]int64
+}
+
+// NewSummary : commandの実行結果を集計するSummaryを生成する。
+func NewSummary(command string) *Summary {
+	return &Summary{Command: command, counts: map[string]int64{}}
+}
+
+// Add : keyの件数にnを加える。sがnilなら何もしない。
+func (s *Summary) Add(key string, n int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.counts[key]; !ok {
+		s.keys = append(s.keys, key)
+	}
+	s.counts[key] += n
+}
+
+// Attrs : ログに出力するための属性を、件数は加えられた順に返す。
+func (s *Summary) Attrs() []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attrs := []any{
+		slog.String("command", s.Command),
+		slog.String("status", s.Status),
+		slog.Duration("duration", s.Duration.Round(time.Millisecond)),
+	}
+	for _, k := range s.keys {
+		attrs = append(attrs, slog.Int64(k, s.counts[k]))
+	}
+	return attrs
+}
+
+func (s *Summary) MarshalJSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Marshal(struct {
+		Command  string           `json:"command"`
+		Status   string           `json:"status"`
+		Duration float64          `json:"duration_sec"`
+		Counts   map[string]int64 `json:"counts"`
+	}{s.Command, s.Status, s.Duration.Seconds(), s.counts})
+}
+
+type summaryKey struct{}
+
+// WithSummary : sを保持するctxを返す。
+func WithSummary(ctx context.Context, s *Summary) context.Context {
+	return context.WithValue(ctx, summaryKey{}, s)
+}
+
+// SummaryFrom : ctxが保持するSummaryを返す。なければnilを返す。
+func SummaryFrom(ctx context.Context) *Summary {
+	s, _ := ctx.Value(summaryKey{}).(*Summary)
+	return s
+}
+
+// Progress : 件数の決まった長時間の処理の進捗を報告する。
+// 端末では進捗バーを、そうでなければ一定間隔でログを出力する。
+// 並列に呼び出してよい。
+type Progress struct {
+	mu sync.Mutex
+	// 処理の対象の名前。ログとSummaryのキーに用いる。
+	name string
+	// 処理に成功した件数の呼び方。"downloaded"など。
+	doneLabel string
+	total     int64
+	done      int64
+	skipped   int64
+	failed    int64
+	bytes     int64
+	start     time.Time
+	last      time.Time
+	tty       io.Writer
+	summary   *Summary
+}
+
+// NewProgress : total件のnameを処理する進捗を生成する。
+// Finish()でctxのSummaryに"${name}_${doneLabel}"などの件数を加える。
+func NewProgress(ctx context.Context, name, doneLabel string, total int) *Progress {
+	progressMu.Lock()
+	tty := progressTTY
+	progressMu.Unlock()
+	now := time.Now()
+	return &Progress{
+		name:      name,
+		doneLabel: doneLabel,
+		total:     int64(total),
+		start:     now,
+		last:      now,
+		tty:       tty,
+		summary:   SummaryFrom(ctx),
+	}
+}
+
+// Done : 一件の処理に成功し、bytesバイトを書き出した。
+func (p *Progress) Done(bytes int64) {
+	p.update(func() { p.done++; p.bytes += bytes })
+}
+
+// Skip : 一件を処理する必要がなかった。
+func (p *Progress) Skip() {
+	p.update(func() { p.skipped++ })
+}
+
+// Fail : 一件の処理に失敗した。
+func (p *Progress) Fail() {
+	p.update(func() { p.failed++ })
+}
+
+// Failed : 失敗した件数を返す。
+func (p *Progress) Failed() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.failed
+}
+
+func (p *Progress) update(fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fn()
+	now := time.Now()
+	interval := progressLogInterval
+	if p.tty != nil {
+		interval = progressBarInterval
+	}
+	if now.Sub(p.last) < interval {
+		return
+	}
+	p.last = now
+	p.report(now)
+}
+
+// Finish : 最終的な件数を出力し、Summaryに加える。
+func (p *Progress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty != nil {
+		p.report(time.Now())
+		fmt.Fprintln(p.tty)
+	}
+	slog.Info(p.name+" finished",
+		p.doneLabel, p.done,
+		"skipped", p.skipped,
+		"failed", p.failed,
+		"bytes", p.bytes,
+		"duration", time.Since(p.start).Round(time.Millisecond))
+	p.summary.Add(p.name+"_"+p.doneLabel, p.done)
+	p.summary.Add(p.name+"_skipped", p.skipped)
+	p.summary.Add(p.name+"_failed", p.failed)
+	if p.bytes > 0 {
+		p.summary.Add(p.name+"_bytes", p.bytes)
+	}
+}
+
+// eta : 残りの処理にかかる時間の見込みを返す。見込めない場合は0を返す。
+func (p *Progress) eta(now time.Time) time.Duration {
+	n := p.done + p.skipped + p.failed
+	if n == 0 || n >= p.total {
+		return 0
+	}
+	elapsed := now.Sub(p.start)
+	return time.Duration(float64(elapsed) / float64(n) * float64(p.total-n)).Round(time.Second)
+}
+
+func (p *Progress) report(now time.Time) {
+	n := p.done + p.skipped + p.failed
+	if p.tty == nil {
+		slog.Info(p.name+" in progress",
+			"processed", n,
+			"total", p.total,
+			"failed", p.failed,
+			"bytes", p.bytes,
+			"eta", p.eta(now))
+		return
+	}
+	ratio := 1.0
+	if p.total > 0 {
+		ratio = float64(n) / float64(p.total)
+	}
+	filled := int(ratio * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	line := fmt.Sprintf("%s [%s] %d/%d (%3.0f%%)", p.name, bar, n, p.total, ratio*100)
+	if p.bytes > 0 {
+		line += " " + formatBytes(p.bytes)
+	}
+	if eta := p.eta(now); eta > 0 {
+		line += " ETA " + eta.String()
+	}
+	// clear the rest of the previous line.
+	fmt.Fprintf(p.tty, "\r%s\x1b[K", line)
+}
+
+// formatBytes : バイト数を読みやすい単位で返す。
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,250 @@
+package slacklog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PublishResult : 公開前後の出力ディレクトリの差分。
+// 各パスは出力ディレクトリからの相対パスである。
+type PublishResult struct {
+	// 新たに生成されたページ
+	Added []string
+	// 内容が変わったページ
+	Updated []string
+	// 生成されなくなったため削除されたページ
+	Removed []string
+	// 内容が変わらなかったページの数
+	Unchanged int
+	// Config.SiteDirに書き出したサイトのファイルの数
+	SiteFiles int
+}
+
+// GenerateAndPublish : outDirと同じディレクトリに作成した一時ディレクトリにペー
+// ジを生成し、成功した場合のみoutDirと入れ替える。
+// そのため生成が失敗したり中断された場合でもoutDirは元の状態のまま残り、生成さ
+// れなくなったページ(ホワイトリストから外れたチャンネルなど)は入れ替えによって
+// 削除される。
+// ただし入れ替えの途中でプロセスが終了した場合はoutDirがなくなり、元の内容が
+// backupDir()に残る。その場合は次の実行時に最初にrecoverSwap()で元に戻す。生成
+// の途中で終了した場合に残る一時ディレクトリも、recoverSwap()で削除する。
+// Config.SiteDirが指定されていれば、入れ替えた後にサイトのファイルをそこに書
+// き出す。指定されていなければ、outDirの_config.ymlなどのサイト毎のファイルを
+// keepSiteFiles()で引き継ぐ。
+// dryRunがtrueの場合はoutDirを変更せず、入れ替えた場合の差分のみを返す。
+func (g *HTMLGenerator) GenerateAndPublish(ctx context.Context, outDir string, dryRun bool) (*PublishResult, error) {
+	outDir = filepath.Clean(outDir)
+	if err := recoverSwap(outDir); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(outDir), stagingPrefix(outDir))
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := g.Generate(ctx, staging); err != nil {
+		return nil, err
+	}
+	if g.cfg.SiteDir == "" {
+		// the site files are written into staging, which has no _config.yml
+		// edited by the user yet.
+		if err := keepSiteFiles(outDir, staging); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := diffDirs(outDir, staging)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return res, nil
+	}
+	if err := swapDir(staging, outDir); err != nil {
+		return nil, err
+	}
+	if g.cfg.SiteDir != "" {
+		res.SiteFiles, err = WriteSiteFiles(g.cfg.SiteDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write site files: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// backupDir : swapDir()がdstを入れ替える間、元の内容を置いておくディレクトリの
+// パスを返す。
+func backupDir(dst string) string {
+	return filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".old")
+}
+
+// stagingPrefix : GenerateAndPublish()がdstと同じディレクトリに作る一時ディレ
+// クトリの名前の接頭辞を返す。
+func stagingPrefix(dst string) string {
+	return "." + filepath.Base(dst) + ".staging-"
+}
+
+// swapDir : newDirをdstに移動する。dstが既に存在する場合は置き換える。
+// newDirとdstは同じファイルシステム上にある必要がある。
+// 二つのrenameの間はdstが存在せず、元の内容はbackupDir(dst)にある。この間に
+// プロセスが終了した場合はrecoverSwap()で元に戻せる。
+func swapDir(newDir, dst string) error {
+	// os.MkdirTemp creates a directory with 0700.
+	if err := os.Chmod(newDir, 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		return os.Rename(newDir, dst)
+	}
+	old := backupDir(dst)
+	// os.Rename can't replace a non-empty directory, so move dst aside first.
+	if err := os.Rename(dst, old); err != nil {
+		return err
+	}
+	if err := os.Rename(newDir, dst); err != nil {
+		// restore the previous output.
+		if rerr := os.Rename(old, dst); rerr != nil {
+			return fmt.Errorf("%w (and failed to restore %s from %s: %s)", err, dst, old, rerr)
+		}
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// recoverSwap : 中断されたGenerateAndPublish()とswapDir()の後始末をする。
+// 生成の途中で終了した場合に残る一時ディレクトリを削除する。
+// dstがなくbackupDir(dst)がある場合は、入れ替えの途中で終了したものとして元に
+// 戻す。両方ある場合は入れ替えを終えた後に終了したものとして、backupDir(dst)を
+// 削除する。
+func recoverSwap(dst string) error {
+	if err := removeStaging(dst); err != nil {
+		return err
+	}
+	old := backupDir(dst)
+	if _, err := os.Stat(old); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		slog.Warn("restoring the output of an interrupted run", "dir", dst, "backup", old)
+		return os.Rename(old, dst)
+	} else if err != nil {
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// removeStaging : 以前の実行が残したdstの一時ディレクトリを削除する。
+func removeStaging(dst string) error {
+	entries, err := os.ReadDir(filepath.Dir(dst))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	prefix := stagingPrefix(dst)
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		path := filepath.Join(filepath.Dir(dst), e.Name())
+		slog.Warn("removing the output of an interrupted run", "dir", path)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffDirs : oldDirとnewDirのファイルを比較する。oldDirが存在しない場合は全て
+// のファイルを追加とみなす。
+func diffDirs(oldDir, newDir string) (*PublishResult, error) {
+	oldFiles, err := listFiles(oldDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	newFiles, err := listFiles(newDir)
+	if err != nil {
+		return nil, err
+	}
+	res := &PublishResult{}
+	for path := range newFiles {
+		oldSize, ok := oldFiles[path]
+		if !ok {
+			res.Added = append(res.Added, path)
+			continue
+		}
+		if oldSize != newFiles[path] {
+			res.Updated = append(res.Updated, path)
+			continue
+		}
+		same, err := sameFileContent(filepath.Join(oldDir, path), filepath.Join(newDir, path))
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			res.Updated = append(res.Updated, path)
+		} else {
+			res.Unchanged++
+		}
+	}
+	for path := range oldFiles {
+		if _, ok := newFiles[path]; !ok {
+			res.Removed = append(res.Removed, path)
+		}
+	}
+	sort.Strings(res.Added)
+	sort.Strings(res.Updated)
+	sort.Strings(res.Removed)
+	return res, nil
+}
+
+// listFiles : dir以下の全てのファイルの相対パスとサイズを返す。
+func listFiles(dir string) (map[string]int64, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	files := map[string]int64{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info.Size()
+		return nil
+	})
+	return files, err
+}
+
+func sameFileContent(a, b string) (bool, error) {
+	ab, err := os.ReadFile(a)
+	if err != nil {
+		return false, err
+	}
+	bb, err := os.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ab, bb), nil
+}
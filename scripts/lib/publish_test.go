@@ -0,0 +1,141 @@
+package slacklog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSwapDir(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "out")
+	writeTestFile(t, filepath.Join(dst, "index.html"), "old")
+	newDir := filepath.Join(dir, "new")
+	writeTestFile(t, filepath.Join(newDir, "index.html"), "new")
+
+	if err := swapDir(newDir, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(dst, "index.html")); got != "new" {
+		t.Errorf("index.html = %q, want %q", got, "new")
+	}
+	for _, path := range []string{newDir, backupDir(dst)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s is left: %v", path, err)
+		}
+	}
+}
+
+func TestRecoverSwap(t *testing.T) {
+	t.Run("interrupted between renames", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "out")
+		writeTestFile(t, filepath.Join(backupDir(dst), "index.html"), "old")
+		if err := recoverSwap(dst); err != nil {
+			t.Fatal(err)
+		}
+		if got := readTestFile(t, filepath.Join(dst, "index.html")); got != "old" {
+			t.Errorf("index.html = %q, want %q", got, "old")
+		}
+		if _, err := os.Stat(backupDir(dst)); !os.IsNotExist(err) {
+			t.Errorf("backup is left: %v", err)
+		}
+	})
+	t.Run("interrupted before removing the backup", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "out")
+		writeTestFile(t, filepath.Join(dst, "index.html"), "new")
+		writeTestFile(t, filepath.Join(backupDir(dst), "index.html"), "old")
+		if err := recoverSwap(dst); err != nil {
+			t.Fatal(err)
+		}
+		if got := readTestFile(t, filepath.Join(dst, "index.html")); got != "new" {
+			t.Errorf("index.html = %q, want %q", got, "new")
+		}
+		if _, err := os.Stat(backupDir(dst)); !os.IsNotExist(err) {
+			t.Errorf("backup is left: %v", err)
+		}
+	})
+	t.Run("interrupted while generating", func(t *testing.T) {
+		dir := t.TempDir()
+		dst := filepath.Join(dir, "out")
+		writeTestFile(t, filepath.Join(dst, "index.html"), "old")
+		staging := filepath.Join(dir, stagingPrefix(dst)+"123")
+		writeTestFile(t, filepath.Join(staging, "index.html"), "partial")
+		other := filepath.Join(dir, stagingPrefix(filepath.Join(dir, "other"))+"456")
+		writeTestFile(t, filepath.Join(other, "index.html"), "other")
+		if err := recoverSwap(dst); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(staging); !os.IsNotExist(err) {
+			t.Errorf("staging directory is left: %v", err)
+		}
+		if _, err := os.Stat(other); err != nil {
+			t.Errorf("staging directory of another output is removed: %v", err)
+		}
+		if got := readTestFile(t, filepath.Join(dst, "index.html")); got != "old" {
+			t.Errorf("index.html = %q, want %q", got, "old")
+		}
+	})
+	t.Run("nothing to recover", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "out")
+		if err := recoverSwap(dst); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(dst); !os.IsNotExist(err) {
+			t.Errorf("%s is created: %v", dst, err)
+		}
+	})
+}
+
+func TestGenerateAndPublish_KeepSiteFiles(t *testing.T) {
+	s := NewMemoryLogStore()
+	s.AddUsers(User{ID: "U1", Name: "alice"})
+	s.AddChannels(Channel{ID: "C1", Name: "general"})
+	if err := s.AddMessages("C1", Message{User: "U1", Text: "hello", Ts: "1577836800.000100"}); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(t.TempDir(), "out")
+	writeTestFile(t, filepath.Join(outDir, "_config.yml"), "title: my archive\n")
+	writeTestFile(t, filepath.Join(outDir, "_includes", "head.html"), "custom")
+	writeTestFile(t, filepath.Join(outDir, "C9", "index.html"), "stale")
+
+	g := NewHTMLGenerator("", s, DefaultConfig())
+	res, err := g.GenerateAndPublish(context.Background(), outDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(outDir, "_config.yml")); got != "title: my archive\n" {
+		t.Errorf("_config.yml = %q, want the existing one", got)
+	}
+	if got := readTestFile(t, filepath.Join(outDir, "_includes", "head.html")); got != "custom" {
+		t.Errorf("_includes/head.html = %q, want the existing one", got)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "_layouts", "slacklog.html")); err != nil {
+		t.Errorf("layout is not written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "C9")); !os.IsNotExist(err) {
+		t.Errorf("stale page is left: %v", err)
+	}
+	if len(res.Removed) != 1 || res.Removed[0] != "C9/index.html" {
+		t.Errorf("Removed = %v, want [C9/index.html]", res.Removed)
+	}
+}
@@ -0,0 +1,139 @@
+package slacklog
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DefaultPermalinkFormat : Slackのメッセージへのリンクの書式の既定値。
+const DefaultPermalinkFormat = "https://{domain}/archives/{channel}/p{ts}"
+
+// SiteParams : 全てのテンプレートに"site"として渡すサイトとワークスペースの情
+// 報。
+type SiteParams struct {
+	// サイトのタイトル。各ページのタイトルの先頭にも付ける。
+	Title string
+	// 生成したページを公開するURL
+	URL string
+	// Slackのワークスペースの名前とドメイン
+	WorkspaceName   string
+	WorkspaceDomain string
+	// 参加方法などを説明するページのURL。空ならリンクしない。
+	AboutURL string
+	// ページの言語
+	Locale string
+	// Config.ExtraLocalesがあれば、他の言語のページへのリンク。なければ空。
+	Alternates []AlternateLocale
+
+	permalinkFormat string
+}
+
+// AlternateLocale : 同じページの他の言語版。
+type AlternateLocale struct {
+	Locale string
+	// 言語の名前。その言語で表記する。
+	Name string
+	// その言語のトップページのURL
+	URL string
+}
+
+// newSiteParams : cfgのサイトをlocaleで生成するためのSiteParamsを返す。
+func newSiteParams(cfg *Config, locale string) *SiteParams {
+	format := cfg.PermalinkFormat
+	if format == "" {
+		format = DefaultPermalinkFormat
+	}
+	s := &SiteParams{
+		Title:           cfg.SiteTitle,
+		URL:             strings.TrimSuffix(cfg.SiteURL, "/"),
+		WorkspaceName:   cfg.WorkspaceName,
+		WorkspaceDomain: cfg.WorkspaceDomain,
+		AboutURL:        cfg.AboutURL,
+		Locale:          locale,
+		permalinkFormat: format,
+	}
+	if len(cfg.ExtraLocales) == 0 {
+		return s
+	}
+	primary := catalogOf(cfg.Locale)
+	if locale != cfg.Locale {
+		// the site root is rewritten by localizeLinks() in the pages of
+		// the extra locales, so refer to it in another form.
+		s.Alternates = append(s.Alternates, AlternateLocale{cfg.Locale, primary.T("locale.name"), `{{ site.baseurl | append: "/" }}`})
+	}
+	for _, l := range cfg.ExtraLocales {
+		if l != locale {
+			s.Alternates = append(s.Alternates, AlternateLocale{l, catalogOf(l).T("locale.name"), "{{ site.baseurl }}/" + l + "/"})
+		}
+	}
+	return s
+}
+
+// SlackPermalink : チャンネルchannelIDのtsのメッセージのSlackでのURLを返す。
+// ワークスペースのドメインが設定されていなければ空文字列を返す。
+func (s *SiteParams) SlackPermalink(channelID, ts string) string {
+	if s.WorkspaceDomain == "" {
+		return ""
+	}
+	return strings.NewReplacer(
+		"{domain}", s.WorkspaceDomain,
+		"{channel}", channelID,
+		"{ts}", strings.Replace(ts, ".", "", 1),
+	).Replace(s.permalinkFormat)
+}
+
+// siteFuncs : サイトと言語に関するテンプレートの関数。
+// 日付の関数はページの言語の書式で表示する。
+func (g *HTMLGenerator) siteFuncs() template.FuncMap {
+	funcs := template.FuncMap{
+		"t":              g.catalog.T,
+		"slackPermalink": g.site.SlackPermalink,
+	}
+	for name, fn := range g.catalog.dateFuncs() {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// executeAndWrite : paramsに"site"を加えてg.templatesのnameのテンプレートを実
+// 行し、filenameに書き出す。
+// Config.ExtraLocalesのページであれば、サイト内のリンクとpermalinkを
+// ${locale}/以下に書き換える。
+func (g *HTMLGenerator) executeAndWrite(name string, params map[string]interface{}, filename string) error {
+	params["site"] = g.site
+	if g.localePrefix != "" {
+		var b bytes.Buffer
+		if err := g.templates.ExecuteTemplate(&b, name, params); err != nil {
+			return err
+		}
+		return os.WriteFile(filename, localizeLinks(b.Bytes(), g.localePrefix), 0666)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return g.templates.ExecuteTemplate(f, name, params)
+}
+
+var (
+	// サイト内のページへのリンク。言語によらないファイルや画像など、他の言語の
+	// ページは除く。
+	rePageLink  = regexp.MustCompile(`\{\{ site\.baseurl \}\}/((?:files|emojis|assets|docs|` + strings.Join(Locales(), "|") + `)/)?`)
+	rePermalink = regexp.MustCompile(`(?m)^permalink: /`)
+)
+
+// localizeLinks : 生成したページのサイト内のリンクとJekyllのpermalinkを、
+// prefix/以下を指すように書き換える。
+func localizeLinks(page []byte, prefix string) []byte {
+	page = rePageLink.ReplaceAllFunc(page, func(m []byte) []byte {
+		if !bytes.HasSuffix(m, []byte("}}/")) {
+			return m
+		}
+		return []byte(string(m) + prefix + "/")
+	})
+	return rePermalink.ReplaceAll(page, []byte("permalink: /"+prefix+"/"))
+}
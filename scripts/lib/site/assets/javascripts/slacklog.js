@@ -0,0 +1,80 @@
+const highlightMsg = (function () {
+  let prevId = '';
+
+  return (hash) => {
+    if (hash === '') return;
+    const id = location.hash.substring(1);
+    const $msg = $('#' + CSS.escape(id));
+    // open thread if inner message is specified by URL fragment
+    $msg.closest('details.slacklog-thread').attr('open', '');
+    // begin highlight animation (see assets/css/slacklog.css)
+    if (prevId !== '') {
+      $('#' + CSS.escape(prevId)).removeClass('slacklog-highlight');
+    }
+    $msg.addClass('slacklog-highlight');
+    prevId = id;
+  };
+})();
+
+window.addEventListener('hashchange', () => {
+  highlightMsg(location.hash);
+});
+window.addEventListener('DOMContentLoaded', () => {
+  highlightMsg(location.hash);
+});
+
+// A busy month is split into several pages (see HTMLGenerator.paginate), so
+// the message specified by URL fragment may be on another page.  Look it up in
+// the month's ts.json and jump to that page.
+const jumpToMessagePage = () => {
+  const hash = location.hash;
+  if (!hash.startsWith('#ts-') || document.getElementById(hash.substring(1))) return;
+  const $month = $('[data-slacklog-ts-map]');
+  if ($month.length === 0) return;
+  $.getJSON($month.attr('data-slacklog-ts-map'), (pages) => {
+    const page = pages[hash.substring('#ts-'.length)];
+    if (page === undefined) return;
+    location.replace($month.attr('data-slacklog-month-url') + page + hash);
+  });
+};
+
+window.addEventListener('hashchange', jumpToMessagePage);
+window.addEventListener('DOMContentLoaded', jumpToMessagePage);
+
+// The permalink page (see HTMLGenerator.generatePermalinkPage) redirects a
+// link to a Slack message given as ?url= to the page of the message in the
+// archive.  The month of the page is that of the ts in the time zone of the
+// log, except for the replies listed in months.json which are shown with the
+// root of the thread posted in an earlier month.
+const slackMonth = (sec, timezone) => {
+  const parts = new Intl.DateTimeFormat('en-US', {
+    timeZone: timezone,
+    year: 'numeric',
+    month: '2-digit',
+  }).formatToParts(new Date(sec * 1000));
+  const part = (type) => parts.find((p) => p.type === type).value;
+  return part('year') + '/' + part('month');
+};
+
+const redirectPermalink = () => {
+  const $page = $('.slacklog-permalink');
+  if ($page.length === 0) return;
+  const url = new URLSearchParams(location.search).get('url');
+  if (!url) return;
+  $page.find('input[name=url]').val(url);
+  const m = /\/archives\/([A-Z0-9]+)\/p(\d{10})(\d{6})/.exec(url);
+  const channels = $page.attr('data-slacklog-channels').split(',');
+  if (!m || !channels.includes(m[1])) {
+    $page.find('.slacklog-permalink-error').removeAttr('hidden');
+    return;
+  }
+  const [, channel, sec, usec] = m;
+  const ts = sec + '.' + usec;
+  $.getJSON($page.attr('data-slacklog-months'), (moved) => {
+    const month = (moved[channel] || {})[ts] ||
+      slackMonth(Number(sec), $page.attr('data-slacklog-timezone'));
+    location.replace($page.attr('data-slacklog-base-url') + channel + '/' + month + '/#ts-' + ts);
+  });
+};
+
+window.addEventListener('DOMContentLoaded', redirectPermalink);
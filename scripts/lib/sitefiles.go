@@ -0,0 +1,99 @@
+package slacklog
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// siteFS : 生成したページをJekyllでサイトにするための、組み込みのレイアウトや
+// CSS、JavaScriptなどのファイル
+//
+//go:embed site/_config.yml site/_layouts site/assets site/favicon.ico site/sitemap.xml
+var siteFS embed.FS
+
+// siteConfigFile : サイト毎に編集するため、既にあれば上書きしないJekyllの設定
+// ファイル
+const siteConfigFile = "_config.yml"
+
+// WriteSiteFiles : 組み込みのレイアウトやCSSなどのファイルをdirに書き出し、書
+// き出したファイルの数を返す。
+// 内容の変わらないファイルと、既にある_config.ymlは書き出さない。
+func WriteSiteFiles(dir string) (int, error) {
+	n := 0
+	err := fs.WalkDir(siteFS, "site", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel := name[len("site/"):]
+		b, err := siteFS.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(rel))
+		if old, err := os.ReadFile(dst); err == nil && (rel == siteConfigFile || bytes.Equal(old, b)) {
+			return nil
+		}
+		if err := writeEmbeddedFile(dst, b); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// writeEmbeddedFile : 組み込みのファイルなどの内容bをdstに書き出す。
+func writeEmbeddedFile(dst string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, b, 0666)
+}
+
+// keepSiteFiles : oldDirにあるサイト毎のファイルをnewDirにコピーする。
+// 既にある_config.ymlと、"_"で始まるJekyllのディレクトリ(_layouts, _includes
+// など)にあってnewDirにないファイルが対象となる。ページが"_"で始まるパスに生
+// 成されることはないため、手で置いたファイルとみなす。
+// oldDirが存在しない場合は何もしない。
+func keepSiteFiles(oldDir, newDir string) error {
+	entries, err := os.ReadDir(oldDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "_") {
+			continue
+		}
+		err := filepath.WalkDir(filepath.Join(oldDir, name), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(oldDir, path)
+			if err != nil {
+				return err
+			}
+			dst := filepath.Join(newDir, rel)
+			if _, err := os.Stat(dst); err == nil && rel != siteConfigFile {
+				return nil
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return writeEmbeddedFile(dst, b)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to keep %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package slacklog
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+const (
+	// defaultSnippetLines : スニペットの最初に表示する行数の既定値
+	defaultSnippetLines = 10
+	// maxSnippetBytes : ページに埋め込むスニペットの最大サイズ。これを超える部
+	// 分は表示せず、ダウンロードのリンクのみとする。
+	maxSnippetBytes = 256 * 1024
+)
+
+// snippetLexer : コードのファイルであれば、Filetypeまたはファイル名から選んだ
+// lexerを返す。コードでなければnilを返す。
+func snippetLexer(f *MessageFile) chroma.Lexer {
+	switch f.TopLevelMimetype() {
+	case "image", "video", "audio":
+		return nil
+	}
+	if f.Filetype == "" || f.Filetype == "text" || f.Filetype == "auto" {
+		return nil
+	}
+	if l := lexerByName(f.Filetype); l != nil {
+		return l
+	}
+	if f.Mode == "snippet" {
+		return lexers.Match(f.Name)
+	}
+	return nil
+}
+
+// readSnippet : ダウンロード済みのファイル、なければエクスポートに含まれるプレ
+// ビューからスニペットの内容を読み込む。
+// 内容が途中までしかない場合はtruncatedがtrueとなる。
+func (g *HTMLGenerator) readSnippet(f *MessageFile) (content string, truncated bool, ok bool) {
+	if g.cfg.FilesDir != "" {
+		if r, err := os.Open(f.LocalFilePath(g.cfg.FilesDir)); err == nil {
+			defer r.Close()
+			b, err := io.ReadAll(io.LimitReader(r, maxSnippetBytes+1))
+			truncated := len(b) > maxSnippetBytes
+			if truncated {
+				// drop the last partial line.
+				b = b[:bytes.LastIndexByte(b[:maxSnippetBytes], '\n')+1]
+			}
+			if err == nil && utf8.Valid(b) {
+				return string(b), truncated, true
+			}
+		}
+	}
+	if f.Preview != "" {
+		return f.Preview, f.PreviewIsTruncated || f.LinesMore > 0, true
+	}
+	return "", false, false
+}
+
+// renderSnippet : コードのファイルの内容を、シンタックスハイライトしてページに
+// 埋め込むHTMLにする。
+// 最初のConfig.SnippetLines行のみを表示し、残りは<details>で折り畳む。
+// コードのファイルでない場合や内容を読み込めない場合は空文字列を返し、テンプレー
+// ト側のダウンロードのリンクに任せる。
+func (g *HTMLGenerator) renderSnippet(f *MessageFile) string {
+	lexer := snippetLexer(f)
+	if lexer == nil {
+		return ""
+	}
+	content, truncated, ok := g.readSnippet(f)
+	if !ok {
+		return ""
+	}
+	n := g.cfg.SnippetLines
+	if n <= 0 {
+		n = defaultSnippetLines
+	}
+	lines := strings.SplitAfter(strings.TrimRight(content, "\n"), "\n")
+	head, ok := highlightCode(strings.Join(lines[:min(n, len(lines))], ""), lexer, true, 1)
+	if !ok {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("<div class='slacklog-snippet'>")
+	fmt.Fprintf(&b, "<div class='slacklog-snippet-title'><a href='{{ site.baseurl }}/files/%s'>%s</a> <span class='slacklog-snippet-type'>%s</span></div>",
+		f.OriginalFilePath(), g.c.escapeSpecialChars(f.Title), html.EscapeString(f.PrettyType))
+	b.WriteString(head)
+	if len(lines) > n {
+		rest, ok := highlightCode(strings.Join(lines[n:], ""), lexer, true, n+1)
+		if ok {
+			fmt.Fprintf(&b, "<details class='slacklog-snippet-more'><summary>%s</summary>%s</details>", g.catalog.T("snippet.more", len(lines)-n), rest)
+		}
+	}
+	if truncated {
+		fmt.Fprintf(&b, "<div class='slacklog-snippet-truncated'><a href='{{ site.baseurl }}/files/%s'>%s</a></div>", f.OriginalFilePath(), g.catalog.T("snippet.download"))
+	}
+	b.WriteString("</div>")
+	return b.String()
+}
+
+// renderTextPreview : プレーンテキストのファイルの最初のConfig.SnippetLines行を
+// 埋め込むHTMLにする。
+// テキストのファイルでない場合や内容を読み込めない場合は空文字列を返す。
+func (g *HTMLGenerator) renderTextPreview(f *MessageFile) string {
+	if !f.IsText() {
+		return ""
+	}
+	content, truncated, ok := g.readSnippet(f)
+	if !ok {
+		return ""
+	}
+	n := g.cfg.SnippetLines
+	if n <= 0 {
+		n = defaultSnippetLines
+	}
+	lines := strings.SplitAfter(strings.TrimRight(content, "\n"), "\n")
+	if len(lines) > n {
+		lines, truncated = lines[:n], true
+	}
+	text := html.EscapeString(strings.Join(lines, ""))
+	text = strings.Replace(text, "{{", "&#123;&#123;", -1)
+	text = strings.Replace(text, "{%", "&#123;&#37;", -1)
+
+	var b strings.Builder
+	b.WriteString("<div class='slacklog-snippet slacklog-file-text'>")
+	fmt.Fprintf(&b, "<div class='slacklog-snippet-title'><a href='{{ site.baseurl }}/files/%s'>%s</a> <span class='slacklog-snippet-type'>%s</span></div>",
+		f.OriginalFilePath(), g.c.escapeSpecialChars(f.Title), html.EscapeString(f.PrettyType))
+	fmt.Fprintf(&b, "<pre class='slacklog-file-text-preview'>%s</pre>", text)
+	if truncated {
+		fmt.Fprintf(&b, "<div class='slacklog-snippet-truncated'><a href='{{ site.baseurl }}/files/%s'>%s</a></div>", f.OriginalFilePath(), g.catalog.T("snippet.download"))
+	}
+	b.WriteString("</div>")
+	return b.String()
+}
+
+// pdfPreview : PDFのファイルのプレビュー画像の、filesディレクトリからのパスを
+// 返す。プレビュー画像がない場合は空文字列を返す。
+// Config.FilesDirが指定されていれば画像がダウンロード済みであるかを確かめる。
+func (g *HTMLGenerator) pdfPreview(f *MessageFile) string {
+	if !f.IsPDF() {
+		return ""
+	}
+	if g.cfg.FilesDir == "" {
+		if f.ThumbPDF == "" {
+			return ""
+		}
+		return f.PDFPreviewPath()
+	}
+	name := f.PDFPreviewFilename()
+	if f.ThumbPDF != "" {
+		name = f.downloadFilenameOf(f.ThumbPDF)
+	}
+	if _, err := os.Stat(filepath.Join(g.cfg.FilesDir, f.ID, name)); err != nil {
+		return ""
+	}
+	return f.PDFPreviewPath()
+}
@@ -0,0 +1,380 @@
+package slacklog
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kyokomi/emoji"
+)
+
+// Stats : LogStoreから集計した統計情報。
+// 各スライスは件数の多い順に並んでいる(Monthsのみ年月順)。
+type Stats struct {
+	Channels     []*ChannelStats     `json:"channels"`
+	Users        []*UserStats        `json:"users"`
+	Months       []*MonthStats       `json:"months"`
+	ChannelUsers []*ChannelUserStats `json:"channel_users"`
+	Emojis       []*EmojiStats       `json:"emojis"`
+	Filetypes    []*FiletypeStats    `json:"filetypes"`
+}
+
+// ChannelStats : チャンネル毎の統計。
+type ChannelStats struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Messages int    `json:"messages"`
+	Threads  int    `json:"threads"`
+	Replies  int    `json:"replies"`
+	// 一つのスレッドへの返信数の最大値
+	MaxReplies int `json:"max_replies"`
+	// スレッドあたりの平均返信数
+	AvgReplies float64 `json:"avg_replies"`
+	Files      int     `json:"files"`
+}
+
+// UserStats : ユーザ毎の統計。
+type UserStats struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Messages          int    `json:"messages"`
+	Replies           int    `json:"replies"`
+	ThreadsStarted    int    `json:"threads_started"`
+	ReactionsGiven    int    `json:"reactions_given"`
+	ReactionsReceived int    `json:"reactions_received"`
+	Files             int    `json:"files"`
+}
+
+// MonthStats : 月毎の統計。全チャンネルの合計である。
+type MonthStats struct {
+	Year     int `json:"year"`
+	Month    int `json:"month"`
+	Messages int `json:"messages"`
+	Threads  int `json:"threads"`
+	Replies  int `json:"replies"`
+}
+
+// ChannelUserStats : チャンネルとユーザの組毎の投稿数。
+type ChannelUserStats struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	Messages    int    `json:"messages"`
+}
+
+// EmojiStats : 絵文字毎の使用回数。
+// KindはEmojiTableに登録されたカスタム絵文字なら"custom"、Unicodeの絵文字なら
+// "unicode"、どちらでもなければ"unknown"となる。
+type EmojiStats struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Reactions int    `json:"reactions"`
+	InText    int    `json:"in_text"`
+}
+
+// Total : リアクションと本文中での使用回数の合計。
+func (e *EmojiStats) Total() int {
+	return e.Reactions + e.InText
+}
+
+// FiletypeStats : MessageFile.Filetype毎のアップロード数と合計サイズ。
+type FiletypeStats struct {
+	Filetype string `json:"filetype"`
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// statsCollector : ComputeStats()の集計途中の状態を保持する。
+type statsCollector struct {
+	s      LogStore
+	emojis map[string]string
+
+	channels     map[string]*ChannelStats
+	users        map[string]*UserStats
+	months       map[MessageMonthKey]*MonthStats
+	channelUsers map[[2]string]*ChannelUserStats
+	emojiStats   map[string]*EmojiStats
+	filetypes    map[string]*FiletypeStats
+}
+
+// ComputeStats : sの全チャンネルのメッセージを月毎に読み込み、統計情報を集計す
+// る。
+// スレッドへの返信は返信が投稿された月に数える。チャンネルにも投稿された返信は
+// 一度だけ数える。
+func ComputeStats(ctx context.Context, s LogStore) (*Stats, error) {
+	c := &statsCollector{
+		s:            s,
+		emojis:       s.GetEmojiMap(),
+		channels:     map[string]*ChannelStats{},
+		users:        map[string]*UserStats{},
+		months:       map[MessageMonthKey]*MonthStats{},
+		channelUsers: map[[2]string]*ChannelUserStats{},
+		emojiStats:   map[string]*EmojiStats{},
+		filetypes:    map[string]*FiletypeStats{},
+	}
+	for _, channel := range s.GetChannels() {
+		cs := &ChannelStats{ID: channel.ID, Name: channel.Name}
+		c.channels[channel.ID] = cs
+		keys, err := s.GetMonthKeys(channel.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			msgs, err := s.GetMessagesOfMonth(channel.ID, key)
+			if err != nil {
+				return nil, err
+			}
+			for _, msg := range msgs {
+				if msg.ThreadTs != "" && !msg.IsRootOfThread() {
+					// thread_broadcast: counted as a reply of the thread.
+					continue
+				}
+				c.addMessage(cs, key, msg)
+				if !msg.IsRootOfThread() {
+					continue
+				}
+				t, ok := s.GetThread(channel.ID, msg.Ts)
+				if !ok || t.ReplyCount() == 0 {
+					continue
+				}
+				c.addThread(cs, key, msg, t)
+			}
+			s.ReleaseMonth(channel.ID, key)
+		}
+		if cs.Threads > 0 {
+			cs.AvgReplies = float64(cs.Replies) / float64(cs.Threads)
+		}
+	}
+	return c.result(), nil
+}
+
+func (c *statsCollector) user(id string) *UserStats {
+	u, ok := c.users[id]
+	if !ok {
+		u = &UserStats{ID: id, Name: c.s.GetDisplayNameByUserID(id)}
+		c.users[id] = u
+	}
+	return u
+}
+
+func (c *statsCollector) month(key MessageMonthKey) *MonthStats {
+	m, ok := c.months[key]
+	if !ok {
+		m = &MonthStats{Year: key.year, Month: key.month}
+		c.months[key] = m
+	}
+	return m
+}
+
+// messageAuthor : 集計に用いる投稿者のIDを返す。ボットの投稿はBotIDで数える。
+func messageAuthor(msg Message) string {
+	if msg.User == "" {
+		return msg.BotID
+	}
+	return msg.User
+}
+
+func (c *statsCollector) addMessage(cs *ChannelStats, key MessageMonthKey, msg Message) {
+	author := messageAuthor(msg)
+	cs.Messages++
+	c.month(key).Messages++
+	u := c.user(author)
+	if u.Name == "" && msg.IsBotMessage() {
+		u.Name = ResolveBotIdentity(&msg, c.s.GetUserByID).Name
+	}
+	u.Messages++
+
+	cu, ok := c.channelUsers[[2]string{cs.ID, author}]
+	if !ok {
+		cu = &ChannelUserStats{
+			ChannelID:   cs.ID,
+			ChannelName: cs.Name,
+			UserID:      author,
+			UserName:    u.Name,
+		}
+		c.channelUsers[[2]string{cs.ID, author}] = cu
+	}
+	cu.Messages++
+
+	for _, r := range msg.Reactions {
+		c.emoji(r.Name).Reactions += r.Count
+		u.ReactionsReceived += r.Count
+		for _, id := range r.Users {
+			c.user(id).ReactionsGiven++
+		}
+	}
+	for _, exp := range reEmoji.FindAllString(msg.Text, -1) {
+		c.emoji(exp[1:len(exp)-1]).InText++
+	}
+	for _, f := range msg.Files {
+		cs.Files++
+		u.Files++
+		ft, ok := c.filetypes[f.Filetype]
+		if !ok {
+			ft = &FiletypeStats{Filetype: f.Filetype}
+			c.filetypes[f.Filetype] = ft
+		}
+		ft.Files++
+		ft.Bytes += f.Size
+	}
+}
+
+func (c *statsCollector) addThread(cs *ChannelStats, key MessageMonthKey, root Message, t *Thread) {
+	n := t.ReplyCount()
+	cs.Threads++
+	cs.Replies += n
+	if n > cs.MaxReplies {
+		cs.MaxReplies = n
+	}
+	c.month(key).Threads++
+	c.user(messageAuthor(root)).ThreadsStarted++
+	for _, reply := range t.Replies() {
+		dt := TsToDateTime(reply.Ts)
+		replyKey := MessageMonthKey{year: dt.Year(), month: int(dt.Month())}
+		c.addMessage(cs, replyKey, reply)
+		c.month(replyKey).Replies++
+		c.user(messageAuthor(reply)).Replies++
+	}
+}
+
+func (c *statsCollector) emoji(name string) *EmojiStats {
+	// reactions with a skin tone are named like "+1::skin-tone-2".
+	if i := strings.Index(name, "::"); i >= 0 {
+		name = name[:i]
+	}
+	e, ok := c.emojiStats[name]
+	if !ok {
+		e = &EmojiStats{Name: name, Kind: c.emojiKind(name)}
+		c.emojiStats[name] = e
+	}
+	return e
+}
+
+func (c *statsCollector) emojiKind(name string) string {
+	if _, ok := c.emojis[name]; ok {
+		return "custom"
+	}
+	if _, ok := emoji.CodeMap()[":"+name+":"]; ok {
+		return "unicode"
+	}
+	return "unknown"
+}
+
+func (c *statsCollector) result() *Stats {
+	st := &Stats{}
+	for _, cs := range c.channels {
+		st.Channels = append(st.Channels, cs)
+	}
+	sort.Slice(st.Channels, func(i, j int) bool {
+		if st.Channels[i].Messages != st.Channels[j].Messages {
+			return st.Channels[i].Messages > st.Channels[j].Messages
+		}
+		return st.Channels[i].Name < st.Channels[j].Name
+	})
+	for _, u := range c.users {
+		st.Users = append(st.Users, u)
+	}
+	sort.Slice(st.Users, func(i, j int) bool {
+		if st.Users[i].Messages != st.Users[j].Messages {
+			return st.Users[i].Messages > st.Users[j].Messages
+		}
+		return st.Users[i].ID < st.Users[j].ID
+	})
+	keys := make([]MessageMonthKey, 0, len(c.months))
+	for key := range c.months {
+		keys = append(keys, key)
+	}
+	sortMessageMonthKeys(keys)
+	for _, key := range keys {
+		st.Months = append(st.Months, c.months[key])
+	}
+	for _, cu := range c.channelUsers {
+		st.ChannelUsers = append(st.ChannelUsers, cu)
+	}
+	sort.Slice(st.ChannelUsers, func(i, j int) bool {
+		a, b := st.ChannelUsers[i], st.ChannelUsers[j]
+		if a.ChannelName != b.ChannelName {
+			return a.ChannelName < b.ChannelName
+		}
+		if a.Messages != b.Messages {
+			return a.Messages > b.Messages
+		}
+		return a.UserID < b.UserID
+	})
+	for _, e := range c.emojiStats {
+		st.Emojis = append(st.Emojis, e)
+	}
+	sort.Slice(st.Emojis, func(i, j int) bool {
+		if st.Emojis[i].Total() != st.Emojis[j].Total() {
+			return st.Emojis[i].Total() > st.Emojis[j].Total()
+		}
+		return st.Emojis[i].Name < st.Emojis[j].Name
+	})
+	for _, ft := range c.filetypes {
+		st.Filetypes = append(st.Filetypes, ft)
+	}
+	sort.Slice(st.Filetypes, func(i, j int) bool {
+		if st.Filetypes[i].Bytes != st.Filetypes[j].Bytes {
+			return st.Filetypes[i].Bytes > st.Filetypes[j].Bytes
+		}
+		return st.Filetypes[i].Filetype < st.Filetypes[j].Filetype
+	})
+	return st
+}
+
+// StatsTables : WriteStatsCSV()で出力できる表の名前。
+var StatsTables = []string{"channels", "users", "months", "channel_users", "emojis", "filetypes"}
+
+// WriteStatsCSV : stのうちtableに指定した表をCSV形式でwに書き出す。
+// tableにはStatsTablesのいずれかを指定する。
+func WriteStatsCSV(w io.Writer, st *Stats, table string) error {
+	itoa := strconv.Itoa
+	var records [][]string
+	switch table {
+	case "channels":
+		records = append(records, []string{"id", "name", "messages", "threads", "replies", "max_replies", "avg_replies", "files"})
+		for _, c := range st.Channels {
+			records = append(records, []string{c.ID, c.Name, itoa(c.Messages), itoa(c.Threads), itoa(c.Replies), itoa(c.MaxReplies), strconv.FormatFloat(c.AvgReplies, 'f', 2, 64), itoa(c.Files)})
+		}
+	case "users":
+		records = append(records, []string{"id", "name", "messages", "replies", "threads_started", "reactions_given", "reactions_received", "files"})
+		for _, u := range st.Users {
+			records = append(records, []string{u.ID, u.Name, itoa(u.Messages), itoa(u.Replies), itoa(u.ThreadsStarted), itoa(u.ReactionsGiven), itoa(u.ReactionsReceived), itoa(u.Files)})
+		}
+	case "months":
+		records = append(records, []string{"month", "messages", "threads", "replies"})
+		for _, m := range st.Months {
+			records = append(records, []string{fmt.Sprintf("%04d-%02d", m.Year, m.Month), itoa(m.Messages), itoa(m.Threads), itoa(m.Replies)})
+		}
+	case "channel_users":
+		records = append(records, []string{"channel_id", "channel_name", "user_id", "user_name", "messages"})
+		for _, cu := range st.ChannelUsers {
+			records = append(records, []string{cu.ChannelID, cu.ChannelName, cu.UserID, cu.UserName, itoa(cu.Messages)})
+		}
+	case "emojis":
+		records = append(records, []string{"name", "kind", "reactions", "in_text"})
+		for _, e := range st.Emojis {
+			records = append(records, []string{e.Name, e.Kind, itoa(e.Reactions), itoa(e.InText)})
+		}
+	case "filetypes":
+		records = append(records, []string{"filetype", "files", "bytes"})
+		for _, ft := range st.Filetypes {
+			records = append(records, []string{ft.Filetype, itoa(ft.Files), strconv.FormatInt(ft.Bytes, 10)})
+		}
+	default:
+		return fmt.Errorf("unknown stats table: %s (must be one of %s)", table, strings.Join(StatsTables, ", "))
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
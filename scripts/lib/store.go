@@ -4,22 +4,108 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
-// LogStore : ログデータを各種テーブルを介して取得するための構造体。
-// MessageTableはチャンネル毎に用意しているためmtsはチャンネルIDをキーとするmap
-// となっている。
-type LogStore struct {
+// LogStore : ログデータを取得するためのインターフェース。
+// HTMLGeneratorはこのインターフェースを介してのみログデータを参照するため、保存
+// 形式の異なるバックエンドを追加してもHTMLGeneratorを変更する必要はない。
+//
+// 以下の実装がある:
+//   - FileLogStore: エクスポートしたJSONのディレクトリから読み込む(デフォルト)
+//   - DBLogStore: BuildDB()で作成したSQLiteデータベースから読み込む
+//   - MemoryLogStore: メモリ上に直接登録したデータを返す(テスト用)
+type LogStore interface {
+	// GetChannels : 対象となるチャンネルをチャンネル名順に返す。
+	GetChannels() []Channel
+	// HasNextMonth : keyの翌月のメッセージが存在するかを返す。
+	HasNextMonth(channelID string, key MessageMonthKey) bool
+	// HasPrevMonth : keyの前月のメッセージが存在するかを返す。
+	HasPrevMonth(channelID string, key MessageMonthKey) bool
+	// GetMessagesPerMonth : チャンネルに表示するメッセージを月毎に返す。
+	// 各月のメッセージは投稿時刻順に並んでいる。
+	GetMessagesPerMonth(channelID string) (map[MessageMonthKey][]Message, error)
+	// GetUserByID : ユーザIDまたはボットIDに対応するユーザを返す。
+	GetUserByID(userID string) (*User, bool)
+	// GetDisplayNameByUserID : ユーザの表示名を返す。見つからない場合は空文字列
+	// を返す。
+	GetDisplayNameByUserID(userID string) string
+	// GetDisplayNameMap : ユーザIDをキーとし、表示名を値とするmapを返す。
+	GetDisplayNameMap() map[string]string
+	// GetEmojiMap : 絵文字名をキーとし、拡張子もしくは"alias:"から始まる別名を
+	// 値とするmapを返す。
+	GetEmojiMap() map[string]string
+	// GetThread : tsを先頭とするスレッドを返す。
+	GetThread(channelID, ts string) (*Thread, bool)
+	// GetContinuedThreads : keyより前の月に先頭メッセージがあり、keyの月にも返
+	// 信が投稿されたスレッドを先頭のtsの順に返す。
+	GetContinuedThreads(channelID string, key MessageMonthKey) []*Thread
+	// GetMessageMonths : チャンネルのページに表示する全てのメッセージのtsと、そ
+	// れを表示する月を返す。
+	// スレッドへの返信は先頭メッセージの月となり、先頭メッセージのない返信は含
+	// まない。チャンネルにも投稿された返信は投稿した月となる。
+	GetMessageMonths(channelID string) (map[string]MessageMonthKey, error)
+	// GetMonthKeys : チャンネルに表示するメッセージが存在する月を昇順で返す。
+	GetMonthKeys(channelID string) ([]MessageMonthKey, error)
+	// GetMessagesOfMonth : keyの月にチャンネルに表示するメッセージを投稿時刻順に
+	// 返す。
+	// GetMessagesPerMonth()と違い一月分のみを読み込むため、全履歴をメモリに置か
+	// ずに処理できる。
+	GetMessagesOfMonth(channelID string, key MessageMonthKey) ([]Message, error)
+	// ReleaseMonth : GetMessagesOfMonth()で読み込んだkeyの月のデータが不要になっ
+	// たことを伝え、バックエンドが保持しているデータを解放させる。
+	ReleaseMonth(channelID string, key MessageMonthKey)
+}
+
+var (
+	_ LogStore = (*FileLogStore)(nil)
+	_ LogStore = (*DBLogStore)(nil)
+	_ LogStore = (*MemoryLogStore)(nil)
+)
+
+// OpenLogStore : pathの種類に応じたLogStoreを生成する。
+// pathがディレクトリであればFileLogStoreを、ファイルであればBuildDB()で作成し
+// たデータベースとみなしてDBLogStoreを生成する。
+func OpenLogStore(path string, cfg *Config) (LogStore, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return NewFileLogStore(path, cfg)
+	}
+	return NewDBLogStore(path, cfg)
+}
+
+// FileLogStore : ログデータを各種テーブルを介して取得するための構造体。
+// メッセージはチャンネル毎のchannelIndexを介して月単位で読み込むため、indexes
+// はチャンネルIDをキーとするmapとなっている。
+type FileLogStore struct {
 	path string
 	ut   *UserTable
 	ct   *ChannelTable
 	et   *EmojiTable
 	// key: channel ID
-	mts map[string]*MessageTable
+	indexes map[string]*lazyChannelIndex
 }
 
-// NewLogStore : 各テーブルを生成して、LogStoreを生成する。
-func NewLogStore(dirPath string, cfg *Config) (*LogStore, error) {
+// lazyChannelIndex : channelIndexを初めて必要になった時に一度だけ生成する。
+type lazyChannelIndex struct {
+	once sync.Once
+	dir  string
+	idx  *channelIndex
+	err  error
+}
+
+func (l *lazyChannelIndex) get() (*channelIndex, error) {
+	l.once.Do(func() {
+		l.idx, l.err = newChannelIndex(l.dir)
+	})
+	return l.idx, l.err
+}
+
+// NewFileLogStore : 各テーブルを生成して、FileLogStoreを生成する。
+func NewFileLogStore(dirPath string, cfg *Config) (*FileLogStore, error) {
 	ut, err := NewUserTable(filepath.Join(dirPath, "users.json"))
 	if err != nil {
 		return nil, err
@@ -39,70 +125,99 @@ func NewLogStore(dirPath string, cfg *Config) (*LogStore, error) {
 		// processing.
 	}
 
-	mts := make(map[string]*MessageTable, len(ct.Channels))
+	indexes := make(map[string]*lazyChannelIndex, len(ct.Channels))
 	for _, ch := range ct.Channels {
-		mts[ch.ID] = NewMessageTable()
+		indexes[ch.ID] = &lazyChannelIndex{dir: filepath.Join(dirPath, ch.ID)}
 	}
 
-	return &LogStore{
-		path: dirPath,
-		ut:   ut,
-		ct:   ct,
-		et:   et,
-		mts:  mts,
+	return &FileLogStore{
+		path:    dirPath,
+		ut:      ut,
+		ct:      ct,
+		et:      et,
+		indexes: indexes,
 	}, nil
 }
 
-func (s *LogStore) GetChannels() []Channel {
+func (s *FileLogStore) index(channelID string) (*channelIndex, error) {
+	l, ok := s.indexes[channelID]
+	if !ok {
+		return nil, fmt.Errorf("not found channel: id=%s", channelID)
+	}
+	return l.get()
+}
+
+func (s *FileLogStore) GetChannels() []Channel {
 	return s.ct.Channels
 }
 
-func (s *LogStore) HasNextMonth(channelID string, key MessageMonthKey) bool {
-	if mt, ok := s.mts[channelID]; ok && mt != nil {
-		_, ok := mt.MsgsMap[key.Next()]
+func (s *FileLogStore) HasNextMonth(channelID string, key MessageMonthKey) bool {
+	if idx, err := s.index(channelID); err == nil {
+		_, ok := idx.shown[key.Next()]
 		return ok
 	}
 	return false
 }
 
-func (s *LogStore) HasPrevMonth(channelID string, key MessageMonthKey) bool {
-	if mt, ok := s.mts[channelID]; ok && mt != nil {
-		_, ok := mt.MsgsMap[key.Prev()]
+func (s *FileLogStore) HasPrevMonth(channelID string, key MessageMonthKey) bool {
+	if idx, err := s.index(channelID); err == nil {
+		_, ok := idx.shown[key.Prev()]
 		return ok
 	}
 	return false
 }
 
-func (s *LogStore) GetMessagesPerMonth(channelID string) (map[MessageMonthKey][]Message, error) {
-	mt, ok := s.mts[channelID]
-	if !ok {
-		return nil, fmt.Errorf("not found channel: id=%s", channelID)
+func (s *FileLogStore) GetMonthKeys(channelID string) ([]MessageMonthKey, error) {
+	idx, err := s.index(channelID)
+	if err != nil {
+		return nil, err
 	}
-	if err := mt.ReadLogDir(filepath.Join(s.path, channelID)); err != nil {
+	return append([]MessageMonthKey(nil), idx.months...), nil
+}
+
+func (s *FileLogStore) GetMessagesOfMonth(channelID string, key MessageMonthKey) ([]Message, error) {
+	idx, err := s.index(channelID)
+	if err != nil {
 		return nil, err
 	}
+	return idx.loadMonth(key)
+}
 
-	return mt.MsgsMap, nil
+func (s *FileLogStore) ReleaseMonth(channelID string, key MessageMonthKey) {
+	if idx, err := s.index(channelID); err == nil {
+		idx.release(key)
+	}
 }
 
-func (s *LogStore) GetUserByID(userID string) (*User, bool) {
+// GetMessagesPerMonth : チャンネルの全ての月のメッセージを読み込んで返す。
+// 読み込んだデータは保持し続けるため、大きなチャンネルではGetMonthKeys()と
+// GetMessagesOfMonth()を用いて月毎に処理すること。
+func (s *FileLogStore) GetMessagesPerMonth(channelID string) (map[MessageMonthKey][]Message, error) {
+	idx, err := s.index(channelID)
+	if err != nil {
+		return nil, err
+	}
+	msgsMap := make(map[MessageMonthKey][]Message, len(idx.months))
+	for _, key := range idx.months {
+		msgs, err := idx.loadMonth(key)
+		if err != nil {
+			return nil, err
+		}
+		msgsMap[key] = msgs
+	}
+	return msgsMap, nil
+}
+
+func (s *FileLogStore) GetUserByID(userID string) (*User, bool) {
 	u, ok := s.ut.UserMap[userID]
 	return u, ok
 }
 
-func (s *LogStore) GetDisplayNameByUserID(userID string) string {
-	if user, ok := s.ut.UserMap[userID]; ok {
-		if user.Profile.RealName != "" {
-			return user.Profile.RealName
-		}
-		if user.Profile.DisplayName != "" {
-			return user.Profile.DisplayName
-		}
-	}
-	return ""
+func (s *FileLogStore) GetDisplayNameByUserID(userID string) string {
+	return s.ut.DisplayName(userID)
 }
 
-func (s *LogStore) GetDisplayNameMap() map[string]string {
+func (s *FileLogStore) GetDisplayNameMap() map[string]string {
 	ret := make(map[string]string, len(s.ut.UserMap))
 	for id, u := range s.ut.UserMap {
 		ret[id] = s.GetDisplayNameByUserID(u.ID)
@@ -110,17 +225,33 @@ func (s *LogStore) GetDisplayNameMap() map[string]string {
 	return ret
 }
 
-func (s *LogStore) GetEmojiMap() map[string]string {
+func (s *FileLogStore) GetEmojiMap() map[string]string {
+	if s.et == nil {
+		return map[string]string{}
+	}
 	return s.et.URLMap
 }
 
-func (s *LogStore) GetThread(channelID, ts string) (*Thread, bool) {
-	mt, ok := s.mts[channelID]
-	if !ok {
+func (s *FileLogStore) GetThread(channelID, ts string) (*Thread, bool) {
+	idx, err := s.index(channelID)
+	if err != nil {
 		return nil, false
 	}
-	if t, ok := mt.ThreadMap[ts]; ok {
-		return t, true
+	return idx.thread(ts)
+}
+
+func (s *FileLogStore) GetContinuedThreads(channelID string, key MessageMonthKey) []*Thread {
+	idx, err := s.index(channelID)
+	if err != nil {
+		return nil
+	}
+	return idx.continuedThreads(key)
+}
+
+func (s *FileLogStore) GetMessageMonths(channelID string) (map[string]MessageMonthKey, error) {
+	idx, err := s.index(channelID)
+	if err != nil {
+		return nil, err
 	}
-	return nil, false
+	return idx.messageMonths()
 }
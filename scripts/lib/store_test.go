@@ -0,0 +1,473 @@
+package slacklog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// writeTestLogDir : dirにチャンネルC1のmonths月分のログを、ログデータのディレ
+// クトリと同じ構造で書き出す。
+// 1日にperDay件のメッセージがあり、10件毎にスレッドとなる。スレッドには同じ日
+// の返信に加えて、20日後の返信(チャンネルにも投稿したもの)が付く。
+func writeTestLogDir(tb testing.TB, dir string, months, perDay int) {
+	tb.Helper()
+	write := func(name string, v interface{}) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0666); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	write("channels.json", []Channel{{ID: "C1", Name: "general"}})
+	var users []User
+	for i := 1; i <= 3; i++ {
+		id := "U" + strconv.Itoa(i)
+		users = append(users, User{ID: id, Name: "user" + strconv.Itoa(i), Profile: UserProfile{DisplayName: "user" + strconv.Itoa(i)}})
+	}
+	// a bot, and a bot whose ID is the same as a user ID.
+	users = append(users,
+		User{ID: "B1", Name: "bot", IsBot: true, Profile: UserProfile{RealName: "Bot", BotID: "BB1"}},
+		User{ID: "B2", Name: "confusing", IsBot: true, Profile: UserProfile{RealName: "Confusing Bot", BotID: "U2"}})
+	write("users.json", users)
+	write("emoji.json", map[string]string{"vim": "png"})
+
+	loc, err := time.LoadLocation(DefaultTimezone)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ts := func(t time.Time) string {
+		return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000)
+	}
+	days := map[string][]Message{}
+	add := func(msg Message) {
+		day := TsToDateTime(msg.Ts).Format("2006-01-02")
+		days[day] = append(days[day], msg)
+	}
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, loc)
+	interval := 24 * time.Hour / time.Duration(perDay)
+	n := 0
+	for day := start; day.Before(start.AddDate(0, months, 0)); day = day.AddDate(0, 0, 1) {
+		for i := 0; i < perDay; i++ {
+			t := day.Add(time.Duration(i)*interval + time.Minute)
+			msg := Message{
+				User: "U" + strconv.Itoa(n%3+1),
+				Text: fmt.Sprintf("message %d from <@U1> with `code`, :vim: and https://example.com/%d", n, n),
+				Ts:   ts(t),
+			}
+			n++
+			if n%10 != 0 {
+				add(msg)
+				continue
+			}
+			msg.ThreadTs = msg.Ts
+			add(msg)
+			for j, d := range []time.Duration{time.Second, 2 * time.Second} {
+				add(Message{User: "U" + strconv.Itoa(j+1), Text: "reply", Ts: ts(t.Add(d)), ThreadTs: msg.Ts})
+			}
+			add(Message{Subtype: "thread_broadcast", User: "U3", Text: "late reply", Ts: ts(t.AddDate(0, 0, 20).Add(3 * time.Second)), ThreadTs: msg.Ts})
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "C1"), 0777); err != nil {
+		tb.Fatal(err)
+	}
+	for day, msgs := range days {
+		sortMessages(msgs)
+		write(filepath.Join("C1", day+".json"), msgs)
+	}
+}
+
+func BenchmarkFileLogStore_GenerateMonth(b *testing.B) {
+	if err := SetTimezone(""); err != nil {
+		b.Fatal(err)
+	}
+	dir := b.TempDir()
+	writeTestLogDir(b, dir, 36, 40)
+	cfg := DefaultConfig()
+	s, err := NewFileLogStore(dir, cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	g := NewHTMLGenerator("", s, cfg)
+	if g.templates, err = g.loadTemplates(); err != nil {
+		b.Fatal(err)
+	}
+	g.activity = newActivityCollector()
+	g.dates = newDateIndex()
+	g.documents = newDocumentIndex()
+	channel := s.GetChannels()[0]
+	keys, err := s.GetMonthKeys(channel.ID)
+	if err != nil {
+		b.Fatal(err)
+	}
+	outDir := b.TempDir()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		task := generateTask{channel: channel, key: keys[i%len(keys)]}
+		if err := g.generateTask(outDir, task); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// newMemoryLogStoreFromDir : ログデータのディレクトリdirの内容を全て登録した
+// MemoryLogStoreを生成する。
+func newMemoryLogStoreFromDir(tb testing.TB, dir string) *MemoryLogStore {
+	tb.Helper()
+	ut, err := NewUserTable(filepath.Join(dir, "users.json"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ct, err := NewChannelTable(filepath.Join(dir, "channels.json"), []string{"*"})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	et, err := NewEmojiTable(filepath.Join(dir, "emoji.json"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := NewMemoryLogStore()
+	s.AddUsers(ut.Users...)
+	s.AddChannels(ct.Channels...)
+	for name, value := range et.URLMap {
+		s.AddEmoji(name, value)
+	}
+	for _, ch := range ct.Channels {
+		names, err := readDirNames(filepath.Join(dir, ch.ID))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for _, name := range names {
+			var msgs []Message
+			if err := ReadFileAsJSON(filepath.Join(dir, ch.ID, name), &msgs); err != nil {
+				tb.Fatal(err)
+			}
+			if err := s.AddMessages(ch.ID, msgs...); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return s
+}
+
+type testLogStore struct {
+	name string
+	s    LogStore
+}
+
+// openTestLogStores : 同じログデータdirを読み込んだFileLogStore、DBLogStore、
+// MemoryLogStoreを返す。先頭のFileLogStoreを他と比べる基準とする。
+func openTestLogStores(t *testing.T, dir string) []testLogStore {
+	t.Helper()
+	cfg := DefaultConfig()
+	fs, err := NewFileLogStore(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(t.TempDir(), "log.db")
+	if err := BuildDB(dbPath, dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := NewDBLogStore(dbPath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ds.Close() })
+	return []testLogStore{
+		{"file", fs},
+		{"db", ds},
+		{"memory", newMemoryLogStoreFromDir(t, dir)},
+	}
+}
+
+// threadSummary : スレッドの比較のために、Threadから値を取り出したもの。
+type threadSummary struct {
+	Ts        string
+	HasRoot   bool
+	RootMonth MessageMonthKey
+	Replies   []string
+	Months    []MessageMonthKey
+	Users     []string
+}
+
+func summarizeThread(t *Thread) threadSummary {
+	sum := threadSummary{
+		Ts:        t.Ts(),
+		HasRoot:   t.HasRoot(),
+		RootMonth: t.RootMonth(),
+		Months:    t.Months(),
+		Users:     t.Participants(),
+	}
+	for _, msg := range t.Replies() {
+		sum.Replies = append(sum.Replies, msg.Ts)
+	}
+	return sum
+}
+
+// messageSummary : メッセージの比較のために、ページの表示に関わる値を取り出し
+// たもの。
+type messageSummary struct {
+	Ts, ThreadTs, User, Text string
+	Trail                    bool
+}
+
+func summarizeMessages(msgs []Message) []messageSummary {
+	sums := make([]messageSummary, len(msgs))
+	for i, msg := range msgs {
+		sums[i] = messageSummary{msg.Ts, msg.ThreadTs, msg.User, msg.Text, msg.Trail}
+	}
+	return sums
+}
+
+func TestLogStoreConformance(t *testing.T) {
+	if err := SetTimezone(""); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeTestLogDir(t, dir, 3, 10)
+	stores := openTestLogStores(t, dir)
+	const channelID = "C1"
+	jan := MessageMonthKey{year: 2019, month: 1}
+	// late replies to the threads at the end of March are posted in April.
+	wantKeys := []MessageMonthKey{jan, jan.Next(), jan.Next().Next(), jan.Next().Next().Next()}
+
+	for _, tc := range []struct {
+		name string
+		// fは比較する値を返す。
+		f func(t *testing.T, s LogStore) interface{}
+		// wantがnilでなければ、基準のストアの値と比べる。
+		want interface{}
+	}{
+		{"GetChannels", func(t *testing.T, s LogStore) interface{} {
+			return s.GetChannels()
+		}, nil},
+		{"GetMonthKeys", func(t *testing.T, s LogStore) interface{} {
+			keys, err := s.GetMonthKeys(channelID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return keys
+		}, wantKeys},
+		{"HasNextMonth/HasPrevMonth", func(t *testing.T, s LogStore) interface{} {
+			var has [][2]bool
+			for key := jan.Prev(); !wantKeys[len(wantKeys)-1].Next().before(key); key = key.Next() {
+				has = append(has, [2]bool{s.HasPrevMonth(channelID, key), s.HasNextMonth(channelID, key)})
+			}
+			return has
+		}, [][2]bool{{false, true}, {false, true}, {true, true}, {true, true}, {true, false}, {true, false}}},
+		{"GetMessagesOfMonth", func(t *testing.T, s LogStore) interface{} {
+			months := map[MessageMonthKey][]messageSummary{}
+			for _, key := range wantKeys {
+				msgs, err := s.GetMessagesOfMonth(channelID, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				months[key] = summarizeMessages(msgs)
+				s.ReleaseMonth(channelID, key)
+			}
+			return months
+		}, nil},
+		{"GetMessagesPerMonth", func(t *testing.T, s LogStore) interface{} {
+			msgsMap, err := s.GetMessagesPerMonth(channelID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			months := map[MessageMonthKey][]messageSummary{}
+			for key, msgs := range msgsMap {
+				months[key] = summarizeMessages(msgs)
+			}
+			return months
+		}, nil},
+		{"GetThread", func(t *testing.T, s LogStore) interface{} {
+			var threads []threadSummary
+			for _, key := range wantKeys {
+				msgs, err := s.GetMessagesOfMonth(channelID, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, msg := range msgs {
+					if msg.ThreadTs == "" {
+						continue
+					}
+					th, ok := s.GetThread(channelID, msg.ThreadTs)
+					if !ok {
+						t.Fatalf("thread %s not found", msg.ThreadTs)
+					}
+					threads = append(threads, summarizeThread(th))
+				}
+				s.ReleaseMonth(channelID, key)
+			}
+			if _, ok := s.GetThread(channelID, "1.000000"); ok {
+				t.Error("GetThread() found an unknown thread")
+			}
+			return threads
+		}, nil},
+		{"GetContinuedThreads", func(t *testing.T, s LogStore) interface{} {
+			threads := map[MessageMonthKey][]threadSummary{}
+			for _, key := range wantKeys {
+				for _, th := range s.GetContinuedThreads(channelID, key) {
+					threads[key] = append(threads[key], summarizeThread(th))
+				}
+			}
+			if len(threads[jan]) != 0 || len(threads[jan.Next()]) == 0 {
+				t.Errorf("unexpected continued threads: %v", threads)
+			}
+			return threads
+		}, nil},
+		{"GetMessageMonths", func(t *testing.T, s LogStore) interface{} {
+			months, err := s.GetMessageMonths(channelID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return months
+		}, nil},
+		{"GetUserByID", func(t *testing.T, s LogStore) interface{} {
+			var ids []string
+			for _, id := range []string{"U1", "U3", "U9", "", "B1", "BB1", "U2"} {
+				u, ok := s.GetUserByID(id)
+				if ok {
+					ids = append(ids, u.ID)
+				} else {
+					ids = append(ids, "-")
+				}
+			}
+			return ids
+		}, []string{"U1", "U3", "-", "-", "B1", "B1", "U2"}},
+		{"GetDisplayName", func(t *testing.T, s LogStore) interface{} {
+			m := s.GetDisplayNameMap()
+			if m["BB1"] != "Bot" || m["U2"] != "user2" {
+				t.Errorf("unexpected display names: %v", m)
+			}
+			return []interface{}{m, s.GetDisplayNameByUserID("U2"), s.GetDisplayNameByUserID("BB1"), s.GetDisplayNameByUserID("")}
+		}, nil},
+		{"GetEmojiMap", func(t *testing.T, s LogStore) interface{} {
+			return s.GetEmojiMap()
+		}, map[string]string{"vim": "png"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := tc.want
+			if want == nil {
+				want = tc.f(t, stores[0].s)
+			}
+			for _, st := range stores {
+				got := tc.f(t, st.s)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s store:\n got: %v\nwant: %v", st.name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestLogStoreGenerateConformance : どのLogStoreから生成しても同じページにな
+// ることを確かめる。
+func TestLogStoreGenerateConformance(t *testing.T) {
+	if err := SetTimezone(""); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeTestLogDir(t, dir, 2, 6)
+	cfg := DefaultConfig()
+	cfg.MessagesPerPage = 50
+	cfg.DayPages = true
+	var want map[string]string
+	for _, st := range openTestLogStores(t, dir) {
+		outDir := t.TempDir()
+		if err := NewHTMLGenerator("", st.s, cfg).Generate(context.Background(), outDir); err != nil {
+			t.Fatalf("%s store: %s", st.name, err)
+		}
+		got := map[string]string{}
+		err := filepath.Walk(outDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(outDir, path)
+			got[rel] = string(b)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want == nil {
+			want = got
+			if _, ok := want[filepath.Join("C1", "2019", "01", "page", "2", "index.html")]; !ok {
+				t.Fatalf("%s store: pages are not split: %d files", st.name, len(want))
+			}
+			continue
+		}
+		for name, w := range want {
+			if g, ok := got[name]; !ok {
+				t.Errorf("%s store: %s is not generated", st.name, name)
+			} else if g != w {
+				t.Errorf("%s store: %s differs", st.name, name)
+			}
+		}
+		for name := range got {
+			if _, ok := want[name]; !ok {
+				t.Errorf("%s store: %s is generated unexpectedly", st.name, name)
+			}
+		}
+	}
+}
+
+func TestBuildDB_Threads(t *testing.T) {
+	if err := SetTimezone(""); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeTestLogDir(t, dir, 1, 10)
+	stores := openTestLogStores(t, dir)
+	fs, ds := stores[0].s, stores[1].s.(*DBLogStore)
+
+	rows, err := ds.db.Query(`SELECT thread_ts, root_ts, root_year, root_month, reply_count, reply_users, latest_reply
+FROM threads WHERE channel_id = 'C1' ORDER BY thread_ts`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var (
+			ts, rootTs, users, latest string
+			key                       MessageMonthKey
+			count                     int
+		)
+		if err := rows.Scan(&ts, &rootTs, &key.year, &key.month, &count, &users, &latest); err != nil {
+			t.Fatal(err)
+		}
+		n++
+		th, ok := fs.GetThread("C1", ts)
+		if !ok {
+			t.Fatalf("thread %s is not in the log", ts)
+		}
+		if rootTs != th.Ts() || key != th.RootMonth() || count != th.ReplyCount() || latest != th.LatestReply() {
+			t.Errorf("thread %s: got root %q (%v), %d replies, latest %q; want %q (%v), %d, %q",
+				ts, rootTs, key, count, latest, th.Ts(), th.RootMonth(), th.ReplyCount(), th.LatestReply())
+		}
+		if want := `["U1","U2","U3"]`; users != want {
+			t.Errorf("thread %s: reply_users = %s, want %s", ts, users, want)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// one thread a day in January.
+	if n != 31 {
+		t.Errorf("got %d threads, want 31", n)
+	}
+}
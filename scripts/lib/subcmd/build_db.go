@@ -0,0 +1,25 @@
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"path/filepath"
+
+	slacklog "github.com/vim-jp/slacklog/lib"
+)
+
+var buildDBCommand = &Command{
+	Name:     "build-db",
+	Args:     "[{config.json} {indir} {db-file}]",
+	Summary:  "convert the log data into a SQLite database",
+	Params:   []string{configParam, "log_dir", "db_file"},
+	Requires: []string{"log_dir", "db_file"},
+	Setup: func(fs *flag.FlagSet) func(context.Context, *slacklog.Config, []string) error {
+		return BuildDB
+	},
+}
+
+// BuildDB : ログデータを読み込み、SQLiteデータベースとして出力する。
+func BuildDB(ctx context.Context, cfg *slacklog.Config, args []string) error {
+	return slacklog.BuildDB(filepath.Clean(cfg.DBFile), filepath.Clean(cfg.LogDir), cfg)
+}
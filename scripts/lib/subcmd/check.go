@@ -0,0 +1,60 @@
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	slacklog "github.com/vim-jp/slacklog/lib"
+)
+
+var checkCommand = &Command{
+	Name:     "check",
+	Args:     "[{config.json} {indir|db-file} {outdir}]",
+	Summary:  "report missing files and emojis, and broken links of the log data and the generated pages",
+	Params:   []string{configParam, "log_dir", "out_dir"},
+	Requires: []string{"log_dir"},
+	Setup: func(fs *flag.FlagSet) func(context.Context, *slacklog.Config, []string) error {
+		return Check
+	},
+}
+
+// Check : ログデータと生成したページの参照切れを調べる。
+// 添付ファイル、絵文字の画像、ページは、それぞれcfgのfiles_dir, emojis_dir,
+// out_dirが空でなければ調べる。
+// 問題が見つかった場合はエラーを返し、終了コードを0以外とする。
+func Check(ctx context.Context, cfg *slacklog.Config, args []string) error {
+	s, err := slacklog.OpenLogStore(filepath.Clean(cfg.LogDir), cfg)
+	if err != nil {
+		return err
+	}
+
+	c := slacklog.NewChecker(s)
+	if cfg.FilesDir != "" {
+		c.FilesDir = filepath.Clean(cfg.FilesDir)
+	}
+	if cfg.EmojisDir != "" {
+		c.EmojisDir = filepath.Clean(cfg.EmojisDir)
+	}
+	if cfg.OutDir != "" {
+		c.OutDir = filepath.Clean(cfg.OutDir)
+	}
+
+	issues, err := c.Run(ctx)
+	if err != nil {
+		return err
+	}
+	summary := slacklog.SummaryFrom(ctx)
+	summary.Add("issues", int64(len(issues)))
+	for _, issue := range issues {
+		fmt.Println(issue)
+		summary.Add(issue.Kind, int64(issue.Count))
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("found %d problem(s)", len(issues))
+	}
+	slog.Info("no problems found")
+	return nil
+}
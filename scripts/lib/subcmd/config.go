@@ -0,0 +1,112 @@
+package subcmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	slacklog "github.com/vim-jp/slacklog/lib"
+)
+
+// configParam : コンフィグファイルのパスを指定する位置引数のCommand.Params
+const configParam = "config"
+
+// configFlags : 全てのサブコマンドに共通する、コンフィグの項目を上書きするフラ
+// グ。フラグ名はキーの"_"を"-"に置き換えたものとなる。
+var configFlags = []struct {
+	key   string
+	usage string
+}{
+	{"export_dir", "`dir` of logs exported from Slack"},
+	{"log_dir", "`dir` of the log data, or the db-file of build-db"},
+	{"db_file", "db-`file` to be written by build-db"},
+	{"template_dir", "`dir` of templates overriding the built-in ones"},
+	{"out_dir", "`dir` of the generated pages"},
+	{"site_dir", "`dir` to write the layout and assets of the site (default: out-dir)"},
+	{"files_dir", "`dir` of files downloaded by download-files"},
+	{"emojis_dir", "`dir` of emojis downloaded by download-emoji"},
+	{"channels", "comma separated `names` of channels to output, or *"},
+	{"timezone", "`name` of the time zone to decide the date of messages"},
+	{"workers", "`number` of workers (0: number of CPUs)"},
+	{"site_title", "`title` of the site"},
+	{"site_url", "`URL` where the site is published"},
+	{"workspace_name", "`name` of the Slack workspace"},
+	{"workspace_domain", "`domain` of the Slack workspace"},
+	{"locale", "`locale` of the generated pages (ja or en)"},
+	{"extra_locales", "comma separated `locales` to generate under ${locale}/ as well"},
+}
+
+type configOverride struct {
+	key, value, source string
+}
+
+// configOptions : コンフィグファイルのパスと、位置引数やフラグで上書きする項
+// 目。
+// 各項目は既定値、コンフィグファイル、環境変数、位置引数、フラグの順に上書き
+// する。
+type configOptions struct {
+	path      string
+	params    []configOverride
+	overrides []configOverride
+}
+
+func (o *configOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.path, "config", o.path, "config `file` (default: $"+slacklog.ConfigEnvPrefix+"CONFIG)")
+	for _, f := range configFlags {
+		key := f.key
+		name := strings.ReplaceAll(key, "_", "-")
+		fs.Func(name, f.usage, func(value string) error {
+			o.overrides = append(o.overrides, configOverride{key, value, "-" + name})
+			return nil
+		})
+	}
+}
+
+// setParams : 位置引数argsをparamsの項目に設定し、残りの引数を返す。
+func (o *configOptions) setParams(params []string, args []string) []string {
+	for i, key := range params {
+		if i >= len(args) {
+			return nil
+		}
+		if key == configParam {
+			if o.path == "" {
+				o.path = args[i]
+			}
+			continue
+		}
+		o.params = append(o.params, configOverride{key, args[i], fmt.Sprintf("argument #%d", i+1)})
+	}
+	return args[min(len(params), len(args)):]
+}
+
+// load : コンフィグを読み込み、検証する。
+func (o *configOptions) load() (*slacklog.Config, error) {
+	path := o.path
+	if path == "" {
+		path = os.Getenv(slacklog.ConfigEnvPrefix + "CONFIG")
+	}
+	cfg := slacklog.DefaultConfig()
+	if path != "" {
+		var err error
+		cfg, err = slacklog.ReadConfig(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config: %w", err)
+		}
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	for _, ov := range append(o.params, o.overrides...) {
+		if err := cfg.Set(ov.key, ov.value, ov.source); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := slacklog.SetTimezone(cfg.Timezone); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -8,7 +8,9 @@
 package subcmd
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -17,16 +19,24 @@ import (
 	slacklog "github.com/vim-jp/slacklog/lib"
 )
 
-func ConvertExportedLogs(args []string) error {
-	if len(args) < 2 {
-		fmt.Println("Usage: go run scripts/main.go convert_exported_logs {indir} {outdir}")
-		return nil
-	}
+var convertExportedLogsCommand = &Command{
+	Name:     "convert-exported-logs",
+	Args:     "[{indir} {outdir}]",
+	Summary:  "convert logs exported from Slack into the log data",
+	Params:   []string{"export_dir", "log_dir"},
+	Requires: []string{"export_dir", "log_dir"},
+	Setup: func(fs *flag.FlagSet) func(context.Context, *slacklog.Config, []string) error {
+		return ConvertExportedLogs
+	},
+}
 
-	inDir := filepath.Clean(args[0])
-	outDir := filepath.Clean(args[1])
+// ConvertExportedLogs : cfgのexport_dirにあるSlackからエクスポートしたデータ
+// を、log_dirにログデータとして変換する。
+func ConvertExportedLogs(ctx context.Context, cfg *slacklog.Config, args []string) error {
+	inDir := filepath.Clean(cfg.ExportDir)
+	outDir := filepath.Clean(cfg.LogDir)
 
-	channels, _, err := readChannels(filepath.Join(inDir, "channels.json"), []string{"*"})
+	channels, _, err := readChannels(filepath.Join(inDir, "channels.json"), cfg.Channels)
 	if err != nil {
 		return fmt.Errorf("could not read channels.json: %w", err)
 	}
@@ -45,9 +55,15 @@ func ConvertExportedLogs(args []string) error {
 		return err
 	}
 
+	progress := slacklog.NewProgress(ctx, "channels", "converted", len(channels))
+	defer progress.Finish()
 	for _, channel := range channels {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		messages, err := ReadAllMessages(filepath.Join(inDir, channel.Name))
 		if err != nil {
+			progress.Fail()
 			return err
 		}
 		for _, message := range messages {
@@ -59,12 +75,17 @@ func ConvertExportedLogs(args []string) error {
 			return fmt.Errorf("could not create %s directory: %w", channelDir, err)
 		}
 		messagesPerDay := groupMessagesByDay(messages)
+		var written int64
 		for key, msgs := range messagesPerDay {
-			err = writeMessages(filepath.Join(channelDir, key+".json"), msgs)
+			n, err := writeMessages(filepath.Join(channelDir, key+".json"), msgs)
 			if err != nil {
+				progress.Fail()
 				return err
 			}
+			written += n
 		}
+		progress.Done(written)
+		slacklog.SummaryFrom(ctx).Add("messages", int64(len(messages)))
 	}
 
 	return nil
@@ -134,17 +155,31 @@ func groupMessagesByDay(messages []*slacklog.Message) map[string][]*slacklog.Mes
 	return messagesPerDay
 }
 
-func writeMessages(filename string, messages []*slacklog.Message) error {
+// writeMessages : messagesをfilenameに書き出し、書き出したバイト数を返す。
+func writeMessages(filename string, messages []*slacklog.Message) (int64, error) {
 	file, err := os.Create(filename)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer file.Close()
-	encoder := json.NewEncoder(file)
+	w := &countingWriter{w: file}
+	encoder := json.NewEncoder(w)
 	encoder.SetEscapeHTML(false)
 	err = encoder.Encode(messages)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return w.n, nil
+}
+
+// countingWriter : 書き込んだバイト数を数えるio.Writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
 }
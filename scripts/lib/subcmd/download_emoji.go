@@ -8,31 +8,44 @@
 package subcmd
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 
 	"github.com/slack-go/slack"
+	slacklog "github.com/vim-jp/slacklog/lib"
 )
 
-func DownloadEmoji(args []string) error {
-	slackToken := os.Getenv("SLACK_TOKEN")
+var downloadEmojiCommand = &Command{
+	Name:     "download-emoji",
+	Args:     "[{emojis-dir} [{emoji.json}]]",
+	Summary:  "download custom emojis of the workspace ($SLACK_TOKEN required)",
+	Params:   []string{"emojis_dir"},
+	Extra:    1,
+	Requires: []string{"emojis_dir"},
+	Setup: func(fs *flag.FlagSet) func(context.Context, *slacklog.Config, []string) error {
+		return DownloadEmoji
+	},
+}
+
+// DownloadEmoji : カスタム絵文字の画像をcfgのemojis_dirにダウンロードし、絵文
+// 字の一覧をargs[0](省略時はemojis_dirのemoji.json)に書き出す。
+func DownloadEmoji(ctx context.Context, cfg *slacklog.Config, args []string) error {
+	slackToken := cfg.SlackToken
 	if slackToken == "" {
 		return fmt.Errorf("$SLACK_TOKEN required")
 	}
 
-	if len(args) < 1 {
-		fmt.Println("Usage: go run scripts/main.go download_emoji {emojis-dir}")
-		return nil
-	}
-
-	emojisDir := filepath.Clean(args[0])
+	emojisDir := filepath.Clean(cfg.EmojisDir)
 	emojiJSONPath := filepath.Join(emojisDir, "emoji.json")
-	if 1 < len(args) {
-		emojiJSONPath = filepath.Clean(args[1])
+	if 0 < len(args) {
+		emojiJSONPath = filepath.Clean(args[0])
 	}
 
 	api := slack.New(slackToken)
@@ -47,13 +60,28 @@ func DownloadEmoji(args []string) error {
 		return err
 	}
 
+	progress := slacklog.NewProgress(ctx, "emojis", "downloaded", len(emojis))
 	for name, url := range emojis {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if url[:6] == "alias:" {
+			progress.Skip()
 			continue
 		}
-		downloadEmojiToFile(url, name, emojisDir)
+		n, err := downloadEmojiToFile(url, name, emojisDir)
+		switch {
+		case err != nil:
+			progress.Fail()
+			slog.Warn("download failed", "emoji", name, "err", err)
+		case n < 0:
+			progress.Skip()
+		default:
+			progress.Done(n)
+		}
 		emojis[name] = filepath.Ext(emojis[name])
 	}
+	progress.Finish()
 
 	// write `emojis` to a file as JSON, using with json.Encoder. this saves
 	// memory to marshal JSON.
@@ -70,32 +98,32 @@ func DownloadEmoji(args []string) error {
 	return nil
 }
 
-func downloadEmojiToFile(url, name, basePath string) error {
+// downloadEmojiToFile returns the size of the downloaded image, or -1 if it
+// had been downloaded already.
+func downloadEmojiToFile(url, name, basePath string) (int64, error) {
 	extension := filepath.Ext(url)
 	destFile := filepath.Join(basePath, name+extension)
 	if _, err := os.Stat(destFile); err == nil {
-		return nil
+		return -1, nil
 	}
 
-	fmt.Printf("Downloading: :%s:\n", name)
+	slog.Debug("downloading", "emoji", name)
 
 	resp, err := http.Get(url)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode/100 != 2 {
-		return fmt.Errorf("[%s]: %s", resp.Status, url)
+		return 0, fmt.Errorf("[%s]: %s", resp.Status, url)
 	}
 
 	w, err := os.Create(destFile)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer w.Close()
 
-	_, err = io.Copy(w, resp.Body)
-
-	return err
+	return io.Copy(w, resp.Body)
 }
@@ -8,9 +8,12 @@
 package subcmd
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path"
@@ -23,21 +26,29 @@ import (
 
 const downloadWorkerNum = 8
 
-func DownloadFiles(args []string) error {
-	slackToken := os.Getenv("SLACK_TOKEN")
+var downloadFilesCommand = &Command{
+	Name:     "download-files",
+	Args:     "[{log-dir} {files-dir}]",
+	Summary:  "download files attached to messages ($SLACK_TOKEN required)",
+	Params:   []string{"log_dir", "files_dir"},
+	Requires: []string{"log_dir", "files_dir"},
+	Setup: func(fs *flag.FlagSet) func(context.Context, *slacklog.Config, []string) error {
+		return DownloadFiles
+	},
+}
+
+// DownloadFiles : cfgのlog_dirのメッセージの添付ファイルをfiles_dirにダウン
+// ロードする。
+func DownloadFiles(ctx context.Context, cfg *slacklog.Config, args []string) error {
+	slackToken := cfg.SlackToken
 	if slackToken == "" {
 		return fmt.Errorf("$SLACK_TOKEN required")
 	}
 
-	if len(args) < 2 {
-		fmt.Println("Usage: go run scripts/main.go download_files {log-dir} {files-dir}")
-		return nil
-	}
-
-	logDir := filepath.Clean(args[0])
-	filesDir := filepath.Clean(args[1])
+	logDir := filepath.Clean(cfg.LogDir)
+	filesDir := filepath.Clean(cfg.FilesDir)
 
-	s, err := slacklog.NewLogStore(logDir, &slacklog.Config{Channels: []string{"*"}})
+	s, err := slacklog.NewFileLogStore(logDir, cfg)
 	if err != nil {
 		return err
 	}
@@ -46,46 +57,64 @@ func DownloadFiles(args []string) error {
 		return fmt.Errorf("could not create %s directory: %w", filesDir, err)
 	}
 
+	// collect files in messages first, so that the progress knows the total.
+	var files []*slacklog.MessageFile
+	for _, channel := range s.GetChannels() {
+		messages, err := ReadAllMessages(filepath.Join(logDir, channel.ID))
+		if err != nil {
+			return err
+		}
+		for _, message := range messages {
+			for i := range message.Files {
+				files = append(files, &message.Files[i])
+			}
+		}
+	}
+
 	// start download workers.
+	progress := slacklog.NewProgress(ctx, "files", "downloaded", len(files))
 	ch := make(chan *slacklog.MessageFile, downloadWorkerNum)
 	wg := new(sync.WaitGroup)
-	failed := false
 	for i := 0; i < cap(ch); i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for m := range ch {
-				errs := downloadAll(m, filesDir, slackToken)
-				if len(errs) > 0 {
-					failed = true
+				n, errs := downloadAll(m, filesDir, slackToken)
+				switch {
+				case len(errs) > 0:
+					progress.Fail()
 					for i := range errs {
-						fmt.Fprintf(os.Stderr, "[error] Download failed: %s\n", errs[i])
+						slog.Error("download failed", "file", m.ID, "err", errs[i])
 					}
+				case n < 0:
+					progress.Skip()
+				default:
+					progress.Done(n)
 				}
 			}
 		}()
 	}
 
-	// request to download files in messages.
-	channels := s.GetChannels()
-	for _, channel := range channels {
-		messages, err := ReadAllMessages(filepath.Join(logDir, channel.ID))
-		if err != nil {
-			close(ch)
-			return err
-		}
-		for _, message := range messages {
-			for i := range message.Files {
-				ch <- &message.Files[i]
-			}
+	canceled := false
+send:
+	for _, f := range files {
+		select {
+		case ch <- f:
+		case <-ctx.Done():
+			canceled = true
+			break send
 		}
 	}
-
 	close(ch)
 	wg.Wait()
+	progress.Finish()
 
-	if failed {
-		return errors.New("failed to download some file(s)")
+	if canceled {
+		return ctx.Err()
+	}
+	if n := progress.Failed(); n > 0 {
+		return fmt.Errorf("failed to download %d file(s)", n)
 	}
 	return nil
 }
@@ -98,29 +127,99 @@ func urlToFilename(url string) string {
 	return url[i+1:]
 }
 
-func downloadAll(f *slacklog.MessageFile, outDir string, slackToken string) []error {
+// downloadAll downloads the file and its thumbnails, and returns the total
+// size of them.  It returns -1 if all of them had been downloaded already.
+func downloadAll(f *slacklog.MessageFile, outDir string, slackToken string) (int64, []error) {
+	if f.IsExternal {
+		// external files (e.g. Google Drive) can't be fetched with the Slack
+		// token.  generate-html links to them instead.
+		slog.Debug("skipping external file", "file", f.ID, "type", f.ExternalType, "url", f.ExternalURL())
+		return -1, nil
+	}
+
 	fileBaseDir := path.Join(outDir, f.ID)
 	err := os.MkdirAll(fileBaseDir, 0777)
 	if err != nil {
-		return []error{err}
+		return 0, []error{err}
 	}
 
 	var errs []error
+	total := int64(-1)
 
-	for url, suffix := range f.DownloadURLsAndSuffixes() {
-		err = downloadFile(f, fileBaseDir, url, suffix, slackToken)
+	for _, d := range f.DownloadURLsAndSuffixes() {
+		n, err := downloadFile(f, fileBaseDir, d.URL, d.Suffix, slackToken)
 		if err != nil {
 			errs = append(errs, err)
 		}
+		if n >= 0 {
+			total = max(total, 0) + n
+		}
+	}
+
+	if len(errs) == 0 && f.IsDocument() {
+		if err := saveDocument(f, fileBaseDir); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	return errs
+	if len(errs) == 0 && f.IsPDF() && f.ThumbPDF == "" {
+		if err := generatePDFPreview(f, fileBaseDir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return total, errs
 }
 
-func downloadFile(f *slacklog.MessageFile, outDir, url, suffix, slackToken string) error {
-	if url == "" {
+// generatePDFPreview generates the preview image of the first page of a PDF
+// file which Slack did not make a thumbnail for. It is skipped silently if
+// pdftoppm is not installed.
+func generatePDFPreview(f *slacklog.MessageFile, outDir string) error {
+	dest := filepath.Join(outDir, f.PDFPreviewFilename())
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	src := filepath.Join(outDir, f.DownloadFilename(f.URLPrivate, ""))
+	err := slacklog.GeneratePDFPreview(src, dest)
+	if errors.Is(err, slacklog.ErrNoPDFRenderer) {
+		return nil
+	}
+	return err
+}
+
+// saveDocument writes the content of a post or a canvas to document.html
+// for generate-html.  It uses simplified_html of the export if any, or the
+// downloaded file if Slack served it as HTML.
+func saveDocument(f *slacklog.MessageFile, outDir string) error {
+	dest := f.DocumentFilePath(filepath.Dir(outDir))
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	if f.SimplifiedHTML != "" {
+		return os.WriteFile(dest, []byte(f.SimplifiedHTML), 0666)
+	}
+	src := filepath.Join(outDir, f.DownloadFilename(f.URLPrivate, ""))
+	b, err := os.ReadFile(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !strings.HasPrefix(http.DetectContentType(b), "text/html") {
+		// posts are served in Slack's own JSON format, which can't be
+		// rendered.  generate-html uses the preview instead.
 		return nil
 	}
+	return os.WriteFile(dest, b, 0666)
+}
+
+// downloadFile returns the size of the downloaded file, or -1 if it had been
+// downloaded already.
+func downloadFile(f *slacklog.MessageFile, outDir, url, suffix, slackToken string) (int64, error) {
+	if url == "" {
+		return -1, nil
+	}
 
 	filename := f.DownloadFilename(url, suffix)
 
@@ -128,15 +227,15 @@ func downloadFile(f *slacklog.MessageFile, outDir, url, suffix, slackToken strin
 	_, err := os.Stat(destFile)
 	if err == nil {
 		// Just skip already downloaded file
-		return nil
+		return -1, nil
 	}
 	// `err != nil` has two cases at here. first is "not exist" as expected.
 	// and second is I/O error as unexpected.
 	if !os.IsNotExist(err) {
-		return err
+		return 0, err
 	}
 
-	fmt.Printf("Downloading: %s/%s [%s]\n", f.ID, filename, f.PrettyType)
+	slog.Debug("downloading", "file", f.ID+"/"+filename, "type", f.PrettyType)
 
 	client := &http.Client{}
 	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
@@ -145,28 +244,26 @@ func downloadFile(f *slacklog.MessageFile, outDir, url, suffix, slackToken strin
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	req.Header.Add("Authorization", "Bearer "+slackToken)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode/100 != 2 {
-		return fmt.Errorf("[%s]: %s", resp.Status, url)
+		return 0, fmt.Errorf("[%s]: %s", resp.Status, url)
 	}
 
 	w, err := os.Create(destFile)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer w.Close()
 
-	_, err = io.Copy(w, resp.Body)
-
-	return err
+	return io.Copy(w, resp.Body)
 }
@@ -0,0 +1,41 @@
+package subcmd
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"path/filepath"
+
+	slacklog "github.com/vim-jp/slacklog/lib"
+)
+
+var ejectTemplatesCommand = &Command{
+	Name:     "eject-templates",
+	Args:     "[{templatedir}]",
+	Summary:  "write the built-in templates to customize them",
+	Params:   []string{"template_dir"},
+	Requires: []string{"template_dir"},
+	Setup: func(fs *flag.FlagSet) func(context.Context, *slacklog.Config, []string) error {
+		force := fs.Bool("force", false, "overwrite existing templates")
+		return func(ctx context.Context, cfg *slacklog.Config, args []string) error {
+			return EjectTemplates(ctx, cfg, *force)
+		}
+	},
+}
+
+// EjectTemplates : 組み込みのテンプレートをcfgのtemplate_dirに書き出す。
+// 書き出したテンプレートを編集し、generate-htmlに同じtemplate_dirを指定すると
+// 組み込みのものの代わりに用いられる。
+func EjectTemplates(ctx context.Context, cfg *slacklog.Config, force bool) error {
+	dir := filepath.Clean(cfg.TemplateDir)
+	names, err := slacklog.EjectTemplates(dir, force)
+	for _, name := range names {
+		slog.Debug("ejected", "template", name)
+	}
+	slacklog.SummaryFrom(ctx).Add("templates_written", int64(len(names)))
+	if err != nil {
+		return err
+	}
+	slog.Info("ejected templates", "dir", dir, "files", len(names))
+	return nil
+}
@@ -1,33 +1,75 @@
 package subcmd
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"log/slog"
 	"path/filepath"
 
 	slacklog "github.com/vim-jp/slacklog/lib"
 )
 
+var generateHTMLCommand = &Command{
+	Name:     "generate-html",
+	Args:     "[{config.json} {templatedir} {indir|db-file} {outdir}]",
+	Summary:  "generate the pages of the site from the log data",
+	Params:   []string{configParam, "template_dir", "log_dir", "out_dir"},
+	Requires: []string{"log_dir", "out_dir"},
+	Setup: func(fs *flag.FlagSet) func(context.Context, *slacklog.Config, []string) error {
+		dryRun := fs.Bool("dry-run", false, "list pages to be added, updated and removed without writing outdir")
+		return func(ctx context.Context, cfg *slacklog.Config, args []string) error {
+			return GenerateHTML(ctx, cfg, *dryRun)
+		}
+	},
+}
+
 // GenerateHTML : SlackからエクスポートしたデータをHTMLに変換して出力する。
-func GenerateHTML(args []string) error {
-	if len(args) < 4 {
-		fmt.Println("Usage: go run scripts/main.go generate_html {config.json} {templatedir} {indir} {outdir}")
-		return nil
+// 出力は一時ディレクトリに生成し、成功した場合のみ出力先と入れ替える。
+// dryRunがtrueの場合は出力先を変更せず、変更されるページを一覧する。
+func GenerateHTML(ctx context.Context, cfg *slacklog.Config, dryRun bool) error {
+	// the built-in templates are used if template_dir is not set.
+	templateDir := cfg.TemplateDir
+	if templateDir != "" {
+		templateDir = filepath.Clean(templateDir)
 	}
-	configJSONPath := filepath.Clean(args[0])
-	templateDir := filepath.Clean(args[1])
-	inDir := filepath.Clean(args[2])
-	outDir := filepath.Clean(args[3])
+	inDir := filepath.Clean(cfg.LogDir)
+	outDir := filepath.Clean(cfg.OutDir)
 
-	cfg, err := slacklog.ReadConfig(configJSONPath)
+	s, err := slacklog.OpenLogStore(inDir, cfg)
 	if err != nil {
-		return fmt.Errorf("could not read config: %w", err)
+		return err
 	}
 
-	s, err := slacklog.NewLogStore(inDir, cfg)
+	g := slacklog.NewHTMLGenerator(templateDir, s, cfg)
+	res, err := g.GenerateAndPublish(ctx, outDir, dryRun)
 	if err != nil {
 		return err
 	}
+	summary := slacklog.SummaryFrom(ctx)
+	summary.Add("pages_added", int64(len(res.Added)))
+	summary.Add("pages_updated", int64(len(res.Updated)))
+	summary.Add("pages_removed", int64(len(res.Removed)))
+	summary.Add("pages_unchanged", int64(res.Unchanged))
+	if cfg.SiteDir != "" {
+		summary.Add("site_files_written", int64(res.SiteFiles))
+	}
 
-	g := slacklog.NewHTMLGenerator(templateDir, s)
-	return g.Generate(outDir)
+	if dryRun {
+		for _, path := range res.Added {
+			fmt.Printf("would add: %s\n", path)
+		}
+		for _, path := range res.Updated {
+			fmt.Printf("would update: %s\n", path)
+		}
+		for _, path := range res.Removed {
+			fmt.Printf("would remove: %s\n", path)
+		}
+		return nil
+	}
+	for _, path := range res.Removed {
+		slog.Debug("removed", "path", path)
+	}
+	slog.Info("published", "dir", outDir, "added", len(res.Added), "updated", len(res.Updated), "removed", len(res.Removed), "unchanged", res.Unchanged)
+	return nil
 }
@@ -0,0 +1,65 @@
+package subcmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	slacklog "github.com/vim-jp/slacklog/lib"
+)
+
+var statsCommand = &Command{
+	Name:     "stats",
+	Args:     "[{config.json} {indir|db-file}]",
+	Summary:  "output statistics of the log data in JSON or CSV",
+	Params:   []string{configParam, "log_dir"},
+	Requires: []string{"log_dir"},
+	Setup: func(fs *flag.FlagSet) func(context.Context, *slacklog.Config, []string) error {
+		format := fs.String("format", "json", "output format: json or csv")
+		table := fs.String("table", "channels", "table to output in csv format: "+strings.Join(slacklog.StatsTables, ", "))
+		output := fs.String("o", "", "output file (default: stdout)")
+		return func(ctx context.Context, cfg *slacklog.Config, args []string) error {
+			return Stats(ctx, cfg, *format, *table, *output)
+		}
+	},
+}
+
+// Stats : ログデータの統計情報をJSONもしくはCSV形式で出力する。
+// outputが空なら標準出力に出力する。
+func Stats(ctx context.Context, cfg *slacklog.Config, format, table, output string) error {
+	s, err := slacklog.OpenLogStore(filepath.Clean(cfg.LogDir), cfg)
+	if err != nil {
+		return err
+	}
+
+	st, err := slacklog.ComputeStats(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	case "csv":
+		return slacklog.WriteStatsCSV(w, st, table)
+	}
+	return fmt.Errorf("unknown format: %s", format)
+}
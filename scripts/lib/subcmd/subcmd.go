@@ -1,34 +1,242 @@
 package subcmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	slacklog "github.com/vim-jp/slacklog/lib"
 )
 
-func Run() error {
-	fmt.Println(os.Args)
-	if len(os.Args) < 2 {
-		fmt.Println(`Usage: go run scripts/main.go {subcmd}
-  Subcmd:
-    convert-exported-logs
-    download-emoji
-    download-files
-    generate-html`)
+// progName : Usageに表示するコマンド名
+const progName = "go run scripts/main.go"
+
+// Command : サブコマンドの定義。
+type Command struct {
+	Name string
+	// 位置引数の書式。Usageに表示する。
+	Args string
+	// 一行の説明。Usageに表示する。
+	Summary string
+	// 位置引数を順に設定するコンフィグの項目のキー。configParamの位置引数はコン
+	// フィグファイルのパスとなる。位置引数は省略でき、フラグが優先される。
+	Params []string
+	// Paramsに続けて指定できる、サブコマンド固有の位置引数の数
+	Extra int
+	// 実行に必要なコンフィグの項目のキー
+	Requires []string
+	// fsにサブコマンド固有のフラグを定義し、コンフィグとParams以外の位置引数を
+	// 受け取ってサブコマンドを実行する関数を返す。
+	Setup func(fs *flag.FlagSet) func(ctx context.Context, cfg *slacklog.Config, args []string) error
+}
+
+// commands : 全てのサブコマンド。Usageにはこの順に表示する。
+var commands = []*Command{
+	buildDBCommand,
+	checkCommand,
+	convertExportedLogsCommand,
+	downloadEmojiCommand,
+	downloadFilesCommand,
+	ejectTemplatesCommand,
+	generateHTMLCommand,
+	statsCommand,
+	validateCommand,
+}
+
+// ErrUsage : 引数が正しくない。Usageは表示済みである。
+var ErrUsage = errors.New("invalid arguments")
+
+// ExitCode : Run()が返したエラーに対応する終了コードを返す。
+// ヘルプを表示した場合は0、引数が正しくない場合は2、それ以外のエラーは1となる。
+func ExitCode(err error) int {
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, ErrUsage):
+		return 2
+	}
+	return 1
+}
+
+// logOptions : 全てのサブコマンドに共通するログのフラグ。
+// サブコマンド名の前後どちらにも指定できる。
+type logOptions struct {
+	verbose bool
+	quiet   bool
+	format  string
+	// 実行結果の集計をJSONで書き出すファイル
+	summary string
+}
+
+func (o *logOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.verbose, "verbose", o.verbose, "log debug messages too")
+	fs.BoolVar(&o.quiet, "quiet", o.quiet, "log warnings and errors only")
+	fs.StringVar(&o.format, "log-format", o.format, "log format: text or json")
+	fs.StringVar(&o.summary, "summary", o.summary, "write the summary of the run to `file` as JSON")
+}
+
+// setup : フラグに応じたslogのロガーを標準のロガーとする。
+// ログは標準エラー出力に、サブコマンドの結果は標準出力に出力する。
+func (o *logOptions) setup() error {
+	level := slog.LevelInfo
+	switch {
+	case o.verbose && o.quiet:
+		return errors.New("-verbose and -quiet are exclusive")
+	case o.verbose:
+		level = slog.LevelDebug
+	case o.quiet:
+		level = slog.LevelWarn
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch o.format {
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format: %s", o.format)
+	}
+	slog.SetDefault(slog.New(h))
+	// a progress bar is drawn only between text logs on a terminal.
+	slacklog.SetProgressBar(o.format == "text" && !o.quiet)
+	return nil
+}
+
+// writeSummary : 実行結果の集計をログに出力し、-summaryが指定されていればファ
+// イルに書き出す。
+func (o *logOptions) writeSummary(s *slacklog.Summary) error {
+	slog.Info("summary", s.Attrs()...)
+	if o.summary == "" {
 		return nil
 	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(o.summary, append(b, '\n'), 0666); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return nil
+}
 
-	args := os.Args[2:]
-	subCmdName := os.Args[1]
-	switch subCmdName {
-	case "convert-exported-logs":
-		return ConvertExportedLogs(args)
-	case "download-emoji":
-		return DownloadEmoji(args)
-	case "download-files":
-		return DownloadFiles(args)
-	case "generate-html":
-		return GenerateHTML(args)
+// Run : os.Argsで指定されたサブコマンドを実行する。
+func Run(ctx context.Context) error {
+	opts := &logOptions{format: "text"}
+	copts := &configOptions{}
+	fs := flag.NewFlagSet(progName, flag.ContinueOnError)
+	opts.register(fs)
+	copts.register(fs)
+	fs.Usage = func() { usage(fs) }
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return parseError(err)
+	}
+	args := fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return ErrUsage
 	}
 
-	return fmt.Errorf("unknown subcmd: %s", subCmdName)
+	name := args[0]
+	if name == "help" {
+		if len(args) < 2 {
+			fs.Usage()
+			return nil
+		}
+		name = args[1]
+		args = []string{name, "-help"}
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(fs.Output(), "unknown subcmd: %s\n", name)
+		fs.Usage()
+		return ErrUsage
+	}
+
+	cfs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	opts.register(cfs)
+	copts.register(cfs)
+	run := cmd.Setup(cfs)
+	cfs.Usage = func() { cmd.usage(cfs) }
+	if err := cfs.Parse(args[1:]); err != nil {
+		return parseError(err)
+	}
+	if cfs.NArg() > len(cmd.Params)+cmd.Extra {
+		cfs.Usage()
+		return ErrUsage
+	}
+	if err := opts.setup(); err != nil {
+		return err
+	}
+
+	// .env is optional: $SLACK_TOKEN may be given by the environment.
+	if err := godotenv.Load(); err != nil {
+		slog.Debug("failed to load .env file", "err", err)
+	}
+	rest := copts.setParams(cmd.Params, cfs.Args())
+	cfg, err := copts.load()
+	if err != nil {
+		return err
+	}
+	if err := cfg.Require(cmd.Requires...); err != nil {
+		return err
+	}
+
+	summary := slacklog.NewSummary(cmd.Name)
+	start := time.Now()
+	err = run(slacklog.WithSummary(ctx, summary), cfg, rest)
+	summary.Duration = time.Since(start)
+	summary.Status = "ok"
+	if err != nil {
+		summary.Status = "failed"
+	}
+	if serr := opts.writeSummary(summary); serr != nil && err == nil {
+		err = serr
+	}
+	return err
+}
+
+func findCommand(name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// parseError : フラグの解析のエラーを返す。エラーとUsageはflagパッケージが表
+// 示済みである。
+func parseError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return ErrUsage
+}
+
+func usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintf(w, "Usage: %s [flags] {subcmd} [subcmd flags] {args}\n\nSubcmds:\n", progName)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-22s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s help {subcmd}' for details.\n\nFlags:\n", progName)
+	fs.PrintDefaults()
+}
+
+func (cmd *Command) usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintf(w, "Usage: %s %s [flags] %s\n\n%s\n", progName, cmd.Name, cmd.Args, cmd.Summary)
+	if len(cmd.Requires) > 0 {
+		fmt.Fprintf(w, "\nRequired config: %s\n", strings.Join(cmd.Requires, ", "))
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	fs.PrintDefaults()
 }
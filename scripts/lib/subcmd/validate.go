@@ -0,0 +1,79 @@
+package subcmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	slacklog "github.com/vim-jp/slacklog/lib"
+)
+
+var validateCommand = &Command{
+	Name:     "validate",
+	Args:     "[{config.json} {indir}]",
+	Summary:  "validate the log data converted by convert-exported-logs",
+	Params:   []string{configParam, "log_dir"},
+	Requires: []string{"log_dir"},
+	Setup: func(fs *flag.FlagSet) func(context.Context, *slacklog.Config, []string) error {
+		format := fs.String("format", "text", "output format: text or json")
+		strict := fs.Bool("strict", false, "treat warnings as errors")
+		return func(ctx context.Context, cfg *slacklog.Config, args []string) error {
+			return Validate(ctx, cfg, *format, *strict)
+		}
+	},
+}
+
+// Validate : convert-exported-logsで変換したログデータを検証する。
+// エラー(strictがtrueなら警告も)が見つかった場合はエラーを返し、終了コードを0
+// 以外とする。
+func Validate(ctx context.Context, cfg *slacklog.Config, format string, strict bool) error {
+	v, err := slacklog.NewValidator(filepath.Clean(cfg.LogDir), cfg)
+	if err != nil {
+		return err
+	}
+	diags, err := v.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs, warns int
+	for _, d := range diags {
+		if d.Severity == slacklog.SeverityError {
+			errs++
+		} else {
+			warns++
+		}
+	}
+	summary := slacklog.SummaryFrom(ctx)
+	summary.Add("errors", int64(errs))
+	summary.Add("warnings", int64(warns))
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if diags == nil {
+			diags = []slacklog.Diagnostic{}
+		}
+		if err := enc.Encode(diags); err != nil {
+			return err
+		}
+	case "text":
+		for _, d := range diags {
+			fmt.Println(d)
+		}
+		slog.Info("validated", "errors", errs, "warnings", warns)
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	if errs > 0 || strict && warns > 0 {
+		return fmt.Errorf("validation failed: %d error(s), %d warning(s)", errs, warns)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package slacklog
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateFS : 組み込みの既定のテンプレート。
+// "_"で始まるファイルは、他のテンプレートからdefineの名前で呼び出す部品であ
+// る。
+//
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// templatePattern : テンプレートのファイル名のパターン
+const templatePattern = "*.tmpl"
+
+// loadTemplates : 組み込みのテンプレートとg.templateDirのテンプレートを一つの
+// セットとして読み込む。
+// g.templateDirに同じ名前のファイルや同じ名前のdefineがあれば、組み込みのも
+// のより優先する。g.templateDirが空なら組み込みのテンプレートのみとなる。
+func (g *HTMLGenerator) loadTemplates() (*template.Template, error) {
+	t := template.New("").Delims("<<", ">>").Funcs(g.funcMap())
+	if _, err := t.ParseFS(templateFS, "templates/"+templatePattern); err != nil {
+		return nil, fmt.Errorf("failed to parse built-in templates: %w", err)
+	}
+	if g.templateDir == "" {
+		return t, nil
+	}
+	if _, err := os.Stat(g.templateDir); err != nil {
+		return nil, fmt.Errorf("template dir not found: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(g.templateDir, templatePattern))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		// parse one by one so that an error names the file.
+		if _, err := t.ParseFiles(path); err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// EjectTemplates : 組み込みのテンプレートをdirに書き出し、書き出したファイル
+// 名を返す。書き出したテンプレートはConfig.TemplateDirとして編集できる。
+// forceがfalseの場合、既にあるファイルは上書きせずに*EjectErrorを返す。
+func EjectTemplates(dir string, force bool) ([]string, error) {
+	names, err := fs.Glob(templateFS, "templates/"+templatePattern)
+	if err != nil {
+		return nil, err
+	}
+	if !force {
+		var exists []string
+		for _, name := range names {
+			dst := filepath.Join(dir, path.Base(name))
+			if _, err := os.Stat(dst); err == nil {
+				exists = append(exists, dst)
+			}
+		}
+		if len(exists) > 0 {
+			return nil, &EjectError{Exists: exists}
+		}
+	}
+	var written []string
+	for _, name := range names {
+		b, err := templateFS.ReadFile(name)
+		if err != nil {
+			return written, err
+		}
+		if err := writeEmbeddedFile(filepath.Join(dir, path.Base(name)), b); err != nil {
+			return written, err
+		}
+		written = append(written, path.Base(name))
+	}
+	return written, nil
+}
+
+// EjectError : 書き出すテンプレートのファイルが既にある。
+type EjectError struct {
+	Exists []string
+}
+
+func (e *EjectError) Error() string {
+	return fmt.Sprintf("%d file(s) already exist, use -force to overwrite: %s", len(e.Exists), strings.Join(e.Exists, ", "))
+}
+
+// funcMap : 全てのテンプレートで使える関数。
+func (g *HTMLGenerator) funcMap() template.FuncMap {
+	funcs := g.siteFuncs()
+	for name, fn := range map[string]interface{}{
+		"dict": dict,
+		"formatTs": func(layout, ts string) string {
+			return g.catalog.Format("layout."+layout, TsToDateTime(ts))
+		},
+		"escape": g.c.escapeSpecialChars,
+
+		// messages
+		"visible": g.isVisibleMessage,
+		"datetime": func(ts string) string {
+			return g.catalog.Format("layout.dayTime", TsToDateTime(ts))
+		},
+		"username":        g.userName,
+		"userPageUrl":     g.userPageURL,
+		"userIconUrl":     g.userIconURL,
+		"text":            g.generateMessageText,
+		"attachmentText":  g.generateAttachmentText,
+		"attachmentColor": attachmentColor,
+		"unfurl":          g.renderUnfurl,
+		"snippet":         g.renderSnippet,
+		"textPreview":     g.renderTextPreview,
+		"pdfPreview":      g.pdfPreview,
+		"documentUrl":     g.documentURL,
+		"attachmentLinks": func(a MessageAttachment) []MessageAttachmentAction {
+			var links []MessageAttachmentAction
+			for _, action := range a.Actions {
+				if action.URL != "" {
+					links = append(links, action)
+				}
+			}
+			return links
+		},
+		"attachmentTime": func(ts AttachmentTs) string {
+			return g.catalog.Format("layout.dateMinute", ts.Time())
+		},
+		"mrkdwn": g.c.ToHTML,
+		"archiveUrl": func(u string) string {
+			return g.c.permalinks.rewriteURL(u)
+		},
+
+		// threads and months of a channel
+		"thread": func(channelID, ts string) *Thread {
+			t, _ := g.s.GetThread(channelID, ts)
+			return t
+		},
+		"continuedThreads": g.s.GetContinuedThreads,
+		"threadMtime": func(channelID, ts string) string {
+			if t, ok := g.s.GetThread(channelID, ts); ok && t.ReplyCount() > 0 {
+				return g.catalog.Format("layout.dayTime", t.LastReplyTime())
+			}
+			return ""
+		},
+		"threads": func(channelID, ts string) []Message {
+			if t, ok := g.s.GetThread(channelID, ts); ok {
+				return t.Replies()
+			}
+			return nil
+		},
+		"threadNum": func(channelID, ts string) int {
+			if t, ok := g.s.GetThread(channelID, ts); ok {
+				return t.ReplyCount()
+			}
+			return 0
+		},
+		"threadRootText": func(channelID, ts string) string {
+			thread, ok := g.s.GetThread(channelID, ts)
+			if !ok {
+				return ""
+			}
+			runes := []rune(thread.RootText())
+			text := string(runes)
+			if len(runes) > 20 {
+				text = string(runes[:20]) + " ..."
+			}
+			return g.c.escape(text)
+		},
+		"hasPrevMonth": g.s.HasPrevMonth,
+		"hasNextMonth": g.s.HasNextMonth,
+
+		// users
+		"displayName": func(u *User) string {
+			name := g.s.GetDisplayNameByUserID(u.ID)
+			if name == "" {
+				name = u.Name
+			}
+			return g.c.escapeSpecialChars(name)
+		},
+
+		// documents
+		"messageUrl": func(e *documentEntry) string {
+			return fmt.Sprintf("{{ site.baseurl }}/%s/%s/%s/#ts-%s", e.Channel.ID, e.Key.Year(), e.Key.Month(), e.Msg.Ts)
+		},
+
+		// stats
+		// bar returns the width of a bar in a chart as percentage.
+		"bar": func(n, max int) string {
+			if max <= 0 {
+				return "0"
+			}
+			return fmt.Sprintf("%.1f", float64(n)*100/float64(max))
+		},
+		"bytes": func(n int64) string {
+			const unit = 1024
+			if n < unit {
+				return fmt.Sprintf("%d B", n)
+			}
+			div, exp := int64(unit), 0
+			for m := n / unit; m >= unit; m /= unit {
+				div *= unit
+				exp++
+			}
+			return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+		},
+		"emoji": func(name string) string {
+			return g.c.bindEmoji(":" + name + ":")
+		},
+	} {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// dict : キーと値を交互に並べた引数からmapを作る。
+// 部品のテンプレートに複数の値を渡すために用いる。
+func dict(kvs ...interface{}) (map[string]interface{}, error) {
+	if len(kvs)%2 != 0 {
+		return nil, errors.New("dict: odd number of arguments")
+	}
+	m := make(map[string]interface{}, len(kvs)/2)
+	for i := 0; i < len(kvs); i += 2 {
+		key, ok := kvs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key must be a string, not %T", kvs[i])
+		}
+		m[key] = kvs[i+1]
+	}
+	return m, nil
+}
@@ -5,25 +5,158 @@ import (
 )
 
 // Thread : スレッド
-// rootMsgはスレッドの先頭メッセージを表わす。
-// repliesにはそのスレッドへの返信メッセージが入る。先頭メッセージは含まない。
+// チャンネルの全てのログからtsを先頭とするメッセージを集めたもので、返信が先頭
+// メッセージと別の月に投稿されていても一つのスレッドとなる。
+// rootMsgはスレッドの先頭メッセージを表わす。先頭メッセージが削除されていたり
+// ログに含まれていなかったりする場合はnilとなる。
+// repliesにはそのスレッドへの返信メッセージが投稿時刻順に入る。先頭メッセージは
+// 含まない。
+// monthsにはスレッドのメッセージが投稿された月が昇順で入る。
 type Thread struct {
-	rootMsg *Message
-	replies []Message
+	ts        string
+	rootMsg   *Message
+	rootMonth MessageMonthKey
+	replies   []Message
+	months    []MessageMonthKey
 }
 
+// newThread : tsを先頭とする空のスレッドを生成する。
+func newThread(ts string) *Thread {
+	return &Thread{ts: ts}
+}
+
+// add : keyの月に投稿されたmsgをスレッドに加える。
+// 返信は投稿時刻順となるように加える。
+func (t *Thread) add(key MessageMonthKey, msg Message) {
+	if msg.IsRootOfThread() {
+		t.rootMsg = &msg
+		t.rootMonth = key
+	} else {
+		t.replies = append(t.replies, msg)
+		if n := len(t.replies); n > 1 && t.replies[n-2].Ts > msg.Ts {
+			sortMessages(t.replies)
+		}
+	}
+	for _, k := range t.months {
+		if k == key {
+			return
+		}
+	}
+	t.months = append(t.months, key)
+	if n := len(t.months); n > 1 && key.before(t.months[n-2]) {
+		sortMessageMonthKeys(t.months)
+	}
+}
+
+// Ts : スレッドの先頭メッセージのts
+func (t Thread) Ts() string {
+	return t.ts
+}
+
+// HasRoot : 先頭メッセージがログに含まれているかを返す。
+func (t Thread) HasRoot() bool {
+	return t.rootMsg != nil
+}
+
+// Root : 先頭メッセージを返す。含まれていない場合はnilを返す。
+func (t Thread) Root() *Message {
+	return t.rootMsg
+}
+
+// RootMonth : 先頭メッセージが投稿された月。先頭メッセージが含まれていない場合
+// は最初の返信が投稿された月となる。
+func (t Thread) RootMonth() MessageMonthKey {
+	if t.rootMsg == nil && len(t.months) > 0 {
+		return t.months[0]
+	}
+	return t.rootMonth
+}
+
+// LastReplyTime : 最後の返信の投稿時刻。返信がなければゼロ値を返す。
 func (t Thread) LastReplyTime() time.Time {
+	if len(t.replies) == 0 {
+		return time.Time{}
+	}
 	return TsToDateTime(t.replies[len(t.replies)-1].Ts)
 }
 
+// LatestReply : 最後の返信のts。返信がなければ空文字列を返す。
+func (t Thread) LatestReply() string {
+	if len(t.replies) == 0 {
+		return ""
+	}
+	return t.replies[len(t.replies)-1].Ts
+}
+
 func (t Thread) ReplyCount() int {
 	return len(t.replies)
 }
 
+// RootText : 先頭メッセージの本文。含まれていない場合は空文字列を返す。
 func (t Thread) RootText() string {
+	if t.rootMsg == nil {
+		return ""
+	}
 	return t.rootMsg.Text
 }
 
 func (t Thread) Replies() []Message {
 	return t.replies
 }
+
+// ReplyUsers : 返信したユーザのIDを最初に返信した順に重複なく返す。
+func (t Thread) ReplyUsers() []string {
+	return appendUniqueUsers(nil, t.replies)
+}
+
+// Participants : 先頭メッセージの投稿者と返信したユーザのIDを重複なく返す。
+func (t Thread) Participants() []string {
+	var users []string
+	if t.rootMsg != nil && t.rootMsg.User != "" {
+		users = append(users, t.rootMsg.User)
+	}
+	return appendUniqueUsers(users, t.replies)
+}
+
+func appendUniqueUsers(users []string, msgs []Message) []string {
+	seen := make(map[string]struct{}, len(users))
+	for _, u := range users {
+		seen[u] = struct{}{}
+	}
+	for _, msg := range msgs {
+		if msg.User == "" {
+			continue
+		}
+		if _, ok := seen[msg.User]; !ok {
+			seen[msg.User] = struct{}{}
+			users = append(users, msg.User)
+		}
+	}
+	return users
+}
+
+// Months : スレッドのメッセージが投稿された月を昇順で返す。
+func (t Thread) Months() []MessageMonthKey {
+	return t.months
+}
+
+// MonthsAfter : keyより後にスレッドのメッセージが投稿された月を昇順で返す。
+func (t Thread) MonthsAfter(key MessageMonthKey) []MessageMonthKey {
+	for i, k := range t.months {
+		if key.before(k) {
+			return t.months[i:]
+		}
+	}
+	return nil
+}
+
+// RepliesIn : keyの月に投稿された返信の数を返す。
+func (t Thread) RepliesIn(key MessageMonthKey) int {
+	n := 0
+	for _, msg := range t.replies {
+		if monthKeyOfTs(msg.Ts) == key {
+			n++
+		}
+	}
+	return n
+}
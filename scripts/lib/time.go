@@ -2,32 +2,93 @@ package slacklog
 
 import (
 	"fmt"
-	"os"
+	"log/slog"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-func TsToDateTime(ts string) time.Time {
+// DefaultTimezone : ログの日付を判定するタイムゾーンの既定値。
+// convert-exported-logsはConfig.Timezoneのタイムゾーンでメッセージを日毎のファ
+// イルに分ける。
+const DefaultTimezone = "Asia/Tokyo"
+
+// ParseTs : Slackのts("秒.小数部")をtime.Timeに変換する。
+// 形式が正しくない場合はエラーを返す。
+func ParseTs(ts string) (time.Time, error) {
 	t := strings.Split(ts, ".")
 	if len(t) != 2 {
-		fmt.Fprintf(os.Stderr, "[warning] invalid timestamp: %s ...\n", ts)
-		return time.Time{}
+		return time.Time{}, fmt.Errorf("invalid timestamp: %q", ts)
 	}
 	sec, err := strconv.ParseInt(t[0], 10, 64)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[warning] invalid timestamp: %s ...\n", ts)
-		return time.Time{}
+		return time.Time{}, fmt.Errorf("invalid timestamp: %q", ts)
 	}
 	nsec, err := strconv.ParseInt(t[1], 10, 64)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[warning] invalid timestamp: %s ...\n", ts)
-		return time.Time{}
+		return time.Time{}, fmt.Errorf("invalid timestamp: %q", ts)
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+// logLocation : TsToDateTime()で日時を表すタイムゾーン。SetTimezone()か最初の
+// TsToDateTime()で一度だけ決まり、以後は変わらない。
+var (
+	logLocation     *time.Location
+	logLocationOnce sync.Once
+)
+
+// loadTimezone : nameのタイムゾーンを読み込む。空ならDefaultTimezoneとなる。
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		name = DefaultTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// SetTimezone : TsToDateTime()で日時を表すタイムゾーンを設定する。空なら
+// DefaultTimezoneとなる。
+// ログを読み込み始める前に呼ぶ必要がある。既に異なるタイムゾーンに決まってい
+// る場合はエラーを返す。
+func SetTimezone(name string) error {
+	loc, err := loadTimezone(name)
+	if err != nil {
+		return err
+	}
+	logLocationOnce.Do(func() {
+		logLocation = loc
+	})
+	if logLocation.String() != loc.String() {
+		return fmt.Errorf("timezone is already set to %s", logLocation)
 	}
-	japan, err := time.LoadLocation("Asia/Tokyo")
+	return nil
+}
+
+// timezone : TsToDateTime()で日時を表すタイムゾーンを返す。SetTimezone()が呼ば
+// れていなければDefaultTimezoneに決める。
+// DefaultTimezoneを読み込めない場合(tzdataがない環境など)はUTCとする。
+func timezone() *time.Location {
+	logLocationOnce.Do(func() {
+		loc, err := loadTimezone(DefaultTimezone)
+		if err != nil {
+			slog.Error("using UTC instead", "err", err)
+			loc = time.UTC
+		}
+		logLocation = loc
+	})
+	return logLocation
+}
+
+func TsToDateTime(ts string) time.Time {
+	t, err := ParseTs(ts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[warning] invalid timestamp: %s ...\n", ts)
+		slog.Warn("invalid timestamp", "ts", ts)
 		return time.Time{}
 	}
-	return time.Unix(sec, nsec).In(japan)
+	return t.In(timezone())
 }
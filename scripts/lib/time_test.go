@@ -0,0 +1,26 @@
+package slacklog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetTimezone(t *testing.T) {
+	if err := SetTimezone(""); err != nil {
+		t.Fatal(err)
+	}
+	// the same zone may be set again.
+	if err := SetTimezone(DefaultTimezone); err != nil {
+		t.Errorf("SetTimezone(%q) again: %v", DefaultTimezone, err)
+	}
+	if err := SetTimezone("UTC"); err == nil {
+		t.Error("SetTimezone(\"UTC\") after another zone is set: no error")
+	}
+	if err := SetTimezone("No/Such_Zone"); err == nil || !strings.Contains(err.Error(), "unknown timezone") {
+		t.Errorf("SetTimezone(\"No/Such_Zone\") = %v, want an unknown timezone error", err)
+	}
+	// 2020-01-01 00:00 in Asia/Tokyo
+	if got := TsToDateTime("1577804400.000100").Format("2006-01-02 15:04"); got != "2020-01-01 00:00" {
+		t.Errorf("TsToDateTime() = %s, want 2020-01-01 00:00", got)
+	}
+}
@@ -0,0 +1,152 @@
+package slacklog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// TimelineEntry : タイムラインに表示するメッセージと、それが表示されている月毎
+// のページ。
+type TimelineEntry struct {
+	Channel Channel
+	Key     MessageMonthKey
+	Msg     Message
+	// スレッドへの返信の数
+	ReplyCount int
+}
+
+// generateTimeline : 全チャンネルのメッセージを日毎にまとめたタイムラインを生成
+// する。
+//   - path/
+//     - index.html
+//     - ${YYYY}/
+//       - ${MM}/
+//         - ${DD}/
+//           - index.html
+//
+// 月毎のページと同様に一月ずつ読み込んでは解放する。
+// メッセージファイルの日付とTsToDateTime()の日付は月末で前後することがあるため、
+// ある日のページはその翌月まで読み込んでから生成する。
+func (g *HTMLGenerator) generateTimeline(ctx context.Context, path string, channels []Channel, keysOf map[string][]MessageMonthKey) error {
+	counts := g.dates.dayCounts()
+	days := make([]string, 0, len(counts))
+	for day := range counts {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	// the months of every channel, and the channels having each month.
+	channelsOf := map[MessageMonthKey][]Channel{}
+	var keys []MessageMonthKey
+	for _, channel := range channels {
+		for _, key := range keysOf[channel.ID] {
+			if _, ok := channelsOf[key]; !ok {
+				keys = append(keys, key)
+			}
+			channelsOf[key] = append(channelsOf[key], channel)
+		}
+	}
+	sortMessageMonthKeys(keys)
+
+	pending := map[string][]TimelineEntry{}
+	flush := func(before string) error {
+		ready := make([]string, 0, len(pending))
+		for day := range pending {
+			if before == "" || day < before {
+				ready = append(ready, day)
+			}
+		}
+		for _, day := range ready {
+			if err := g.generateTimelineDay(path, day, days, pending[day]); err != nil {
+				return err
+			}
+			delete(pending, day)
+		}
+		return nil
+	}
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, channel := range channelsOf[key] {
+			msgs, err := g.s.GetMessagesOfMonth(channel.ID, key)
+			if err != nil {
+				return &PageError{ChannelID: channel.ID, Month: &key, Err: err}
+			}
+			for _, msg := range msgs {
+				if !g.isVisibleMessage(msg) {
+					continue
+				}
+				e := TimelineEntry{Channel: channel, Key: key, Msg: msg}
+				if msg.IsRootOfThread() {
+					if t, ok := g.s.GetThread(channel.ID, msg.Ts); ok {
+						e.ReplyCount = t.ReplyCount()
+					}
+				}
+				day := TsToDateTime(msg.Ts).Format(dateLayout)
+				pending[day] = append(pending[day], e)
+			}
+			g.s.ReleaseMonth(channel.ID, key)
+		}
+		// days before this month can no longer get messages.
+		if err := flush(fmt.Sprintf("%s-%s-01", key.Year(), key.Month())); err != nil {
+			return err
+		}
+	}
+	if err := flush(""); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(path, 0777); err != nil {
+		return fmt.Errorf("could not create %s directory: %w", path, err)
+	}
+	params := map[string]interface{}{
+		"calendar": buildCalendar(counts, timelineURL),
+	}
+	return g.executeAndWrite("timeline_index.tmpl", params, filepath.Join(path, "index.html"))
+}
+
+// generateTimelineDay : dayのタイムラインのページを生成する。
+// daysはタイムラインのページがある全ての日を昇順に並べたもので、前後の日へのリ
+// ンクに用いる。
+func (g *HTMLGenerator) generateTimelineDay(path, day string, days []string, entries []TimelineEntry) error {
+	date, err := time.Parse(dateLayout, day)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Msg.Ts < entries[j].Msg.Ts
+	})
+
+	params := map[string]interface{}{
+		"date":    date,
+		"dateDir": date.Format("2006/01/02"),
+		"entries": entries,
+	}
+	i := sort.SearchStrings(days, day)
+	if i > 0 {
+		prev, _ := time.Parse(dateLayout, days[i-1])
+		params["prev"] = prev
+		params["prevUrl"] = timelineURL(prev)
+	}
+	if i+1 < len(days) {
+		next, _ := time.Parse(dateLayout, days[i+1])
+		params["next"] = next
+		params["nextUrl"] = timelineURL(next)
+	}
+
+	dir := filepath.Join(path, date.Format("2006"), date.Format("01"), date.Format("02"))
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("could not create %s directory: %w", dir, err)
+	}
+	return g.executeAndWrite("timeline.tmpl", params, filepath.Join(dir, "index.html"))
+}
+
+// timelineURL : tの日のタイムラインのページのURLを返す。
+func timelineURL(t time.Time) string {
+	return "{{ site.baseurl }}/timeline/" + t.Format("2006/01/02") + "/"
+}
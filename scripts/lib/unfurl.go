@@ -0,0 +1,215 @@
+package slacklog
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// UnfurlRenderer : URLの展開(unfurl)による添付をHTMLにするための定義。
+// ServiceNameとURLPatternの両方に一致する添付に用いる。
+type UnfurlRenderer struct {
+	// 識別のための名前。CSSのクラス名slacklog-attachment-${Name}にも用いる。
+	Name string
+	// 添付のservice_nameがこれと一致する場合に用いる。空なら問わない。
+	ServiceName string
+	// 展開されたURL(from_urlまたはoriginal_url)がこれにマッチする場合に用いる。
+	// nilなら問わない。
+	URLPattern *regexp.Regexp
+	// html/template形式のテンプレート。UnfurlDataを受け取る。
+	Template *template.Template
+}
+
+// UnfurlData : UnfurlRenderer.Templateに渡すデータ。
+type UnfurlData struct {
+	*MessageAttachment
+	// 展開されたURL
+	URL string
+	// URLPatternにマッチした部分と、そのサブマッチ
+	Match []string
+	// Message.Textと同様にHTMLに変換したtext
+	HTMLText template.HTML
+}
+
+var (
+	unfurlMu        sync.RWMutex
+	unfurlRenderers []*UnfurlRenderer
+)
+
+// RegisterUnfurlRenderer : rを登録する。
+// 後に登録したものほど優先して用いる。
+func RegisterUnfurlRenderer(r *UnfurlRenderer) {
+	unfurlMu.Lock()
+	defer unfurlMu.Unlock()
+	unfurlRenderers = append([]*UnfurlRenderer{r}, unfurlRenderers...)
+}
+
+// NewUnfurlRenderer : テンプレートの文字列からUnfurlRendererを生成する。
+// urlPatternが空の場合はURLを問わない。
+func NewUnfurlRenderer(name, serviceName, urlPattern, tmpl string) (*UnfurlRenderer, error) {
+	r := &UnfurlRenderer{Name: name, ServiceName: serviceName}
+	if urlPattern != "" {
+		re, err := regexp.Compile(urlPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL pattern for %s: %w", name, err)
+		}
+		r.URLPattern = re
+	}
+	t, err := template.New(name).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for %s: %w", name, err)
+	}
+	r.Template = t
+	return r, nil
+}
+
+func mustRegisterUnfurlRenderer(name, serviceName, urlPattern, tmpl string) {
+	r, err := NewUnfurlRenderer(name, serviceName, urlPattern, tmpl)
+	if err != nil {
+		panic(err)
+	}
+	RegisterUnfurlRenderer(r)
+}
+
+// unfurlURL : 添付が展開したURLを返す。URLの展開でなければ空文字列を返す。
+func unfurlURL(a *MessageAttachment) string {
+	if a.FromURL != "" {
+		return a.FromURL
+	}
+	return a.OriginalURL
+}
+
+// match : rを添付aに用いるかを判定し、用いる場合はURLPatternにマッチした部分
+// を返す。
+func (r *UnfurlRenderer) match(a *MessageAttachment) ([]string, bool) {
+	if r.ServiceName != "" && r.ServiceName != a.ServiceName {
+		return nil, false
+	}
+	if r.URLPattern == nil {
+		return nil, true
+	}
+	m := r.URLPattern.FindStringSubmatch(unfurlURL(a))
+	return m, m != nil
+}
+
+// findUnfurlRenderer : 添付aに用いるUnfurlRendererを返す。
+func findUnfurlRenderer(a *MessageAttachment) (*UnfurlRenderer, []string) {
+	unfurlMu.RLock()
+	defer unfurlMu.RUnlock()
+	for _, r := range unfurlRenderers {
+		if m, ok := r.match(a); ok {
+			return r, m
+		}
+	}
+	return nil, nil
+}
+
+// renderUnfurl : 添付aをUnfurlRendererでHTMLにする。用いるUnfurlRendererがない
+// 場合は空文字列を返し、テンプレート側の汎用の表示に任せる。
+func (g *HTMLGenerator) renderUnfurl(a MessageAttachment) (string, error) {
+	r, m := findUnfurlRenderer(&a)
+	if r == nil {
+		return "", nil
+	}
+	data := UnfurlData{
+		MessageAttachment: &a,
+		URL:               unfurlURL(&a),
+		Match:             m,
+		HTMLText:          template.HTML(g.c.ToHTML(a.Text)),
+	}
+	var buf bytes.Buffer
+	if err := r.Template.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s unfurl: %w", r.Name, err)
+	}
+	// the output is embedded in a page processed by Jekyll.
+	s := strings.Replace(strings.TrimSpace(buf.String()), "{{", "&#123;&#123;", -1)
+	s = strings.Replace(s, "{%", "&#123;&#37;", -1)
+	return g.c.permalinks.rewriteLinks(s), nil
+}
+
+// The default renderers.  Attachments that none of them matches are rendered
+// by the generic markup in _message.tmpl.
+// Attachments may carry HTML such as video_html, but it is never embedded
+// as is.  Renderers build the markup from the matched URL instead.
+func init() {
+	mustRegisterUnfurlRenderer("github", "GitHub", "", `
+<span class='slacklog-attachment slacklog-attachment-github'>
+  <span class='slacklog-attachment-github-serviceicon'><img src='{{ .ServiceIcon }}'></span>
+  <span class='slacklog-attachment-github-servicename'>{{ .ServiceName }}</span>
+  <span class='slacklog-attachment-github-title'><a href='{{ .TitleLink }}'>{{ .Title }}</a></span>
+  <span class='slacklog-attachment-github-text'>{{ .HTMLText }}</span>
+</span>`)
+
+	mustRegisterUnfurlRenderer("github-issue", "", `^https://github\.com/([^/]+)/([^/]+)/(issues|pull)/(\d+)`, `
+<span class='slacklog-attachment slacklog-attachment-github-issue'>
+  <span class='slacklog-attachment-github-repo'>{{ index .Match 1 }}/{{ index .Match 2 }}</span>
+  <span class='slacklog-attachment-github-kind'>{{ if eq (index .Match 3) "pull" }}Pull Request{{ else }}Issue{{ end }} #{{ index .Match 4 }}</span>
+  <span class='slacklog-attachment-github-title'><a href='{{ .URL }}'>{{ if .Title }}{{ .Title }}{{ else }}{{ .URL }}{{ end }}</a></span>
+  {{- if .Text }}
+  <span class='slacklog-attachment-github-text'>{{ .HTMLText }}</span>
+  {{- end }}
+</span>`)
+
+	mustRegisterUnfurlRenderer("github-commit", "", `^https://github\.com/([^/]+)/([^/]+)/commit/([0-9a-f]{7})[0-9a-f]*`, `
+<span class='slacklog-attachment slacklog-attachment-github-commit'>
+  <span class='slacklog-attachment-github-repo'>{{ index .Match 1 }}/{{ index .Match 2 }}</span>
+  <span class='slacklog-attachment-github-kind'>Commit <code>{{ index .Match 3 }}</code></span>
+  <span class='slacklog-attachment-github-title'><a href='{{ .URL }}'>{{ if .Title }}{{ .Title }}{{ else }}{{ .URL }}{{ end }}</a></span>
+  {{- if .Text }}
+  <span class='slacklog-attachment-github-text'>{{ .HTMLText }}</span>
+  {{- end }}
+</span>`)
+
+	mustRegisterUnfurlRenderer("gist", "", `^https://gist\.github\.com/`, `
+<span class='slacklog-attachment slacklog-attachment-gist'>
+  <span class='slacklog-attachment-gist-title'><a href='{{ .URL }}'>{{ if .Title }}{{ .Title }}{{ else }}{{ .URL }}{{ end }}</a></span>
+  {{- if .Text }}
+  <pre class='slacklog-attachment-gist-text'>{{ .Text }}</pre>
+  {{- end }}
+</span>`)
+
+	mustRegisterUnfurlRenderer("twitter", "twitter", `^https://(?:(?:www|mobile)\.)?(?:twitter|x)\.com/[^/]+/status(?:es)?/(\d+)`, `
+<span class='slacklog-attachment slacklog-attachment-twitter'>
+  <span class='slacklog-attachment-twitter-authoricon'><img src='{{ .AuthorIcon }}'></span>
+  <span class='slacklog-attachment-twitter-authorname'>{{ .AuthorName }}</span>
+  <span class='slacklog-attachment-twitter-authorsubname'>{{ .AuthorSubname }}</span>
+  <span class='slacklog-attachment-twitter-text'>{{ .HTMLText }}</span>
+  <span class='slacklog-attachment-twitter-footericon'><img src='{{ .FooterIcon }}'></span>
+  <span class='slacklog-attachment-twitter-footer'>{{ .Footer }}</span>
+  {{- if .VideoHTML }}
+  <span class='slacklog-attachment-twitter-video'><iframe src='https://twitter.com/i/videos/tweet/{{ index .Match 1 }}'{{ if .VideoHTMLWidth }} width='{{ .VideoHTMLWidth }}' height='{{ .VideoHTMLHeight }}'{{ end }} frameborder='0' allowfullscreen></iframe></span>
+  {{- end }}
+</span>`)
+
+	mustRegisterUnfurlRenderer("youtube", "", `^https://(www\.|m\.)?(youtube\.com/watch|youtu\.be/)`, `
+<span class='slacklog-attachment slacklog-attachment-youtube'>
+  <span class='slacklog-attachment-youtube-title'><a href='{{ .URL }}'>{{ if .Title }}{{ .Title }}{{ else }}{{ .URL }}{{ end }}</a></span>
+  {{- if .AuthorName }}
+  <span class='slacklog-attachment-youtube-author'>{{ .AuthorName }}</span>
+  {{- end }}
+  {{- if .ThumbURL }}
+  <a class='slacklog-attachment-youtube-thumb' href='{{ .URL }}'><img src='{{ .ThumbURL }}' width='{{ .ThumbWidth }}' height='{{ .ThumbHeight }}' alt='{{ .Title }}'></a>
+  {{- end }}
+</span>`)
+
+	mustRegisterUnfurlRenderer("stackoverflow", "", `^https://(ja\.)?stackoverflow\.com/questions/(\d+)`, `
+<span class='slacklog-attachment slacklog-attachment-stackoverflow'>
+  <span class='slacklog-attachment-stackoverflow-servicename'>{{ if .ServiceName }}{{ .ServiceName }}{{ else }}Stack Overflow{{ end }}</span>
+  <span class='slacklog-attachment-stackoverflow-title'><a href='{{ .URL }}'>{{ if .Title }}{{ .Title }}{{ else }}{{ .URL }}{{ end }}</a></span>
+  {{- if .Text }}
+  <span class='slacklog-attachment-stackoverflow-text'>{{ .HTMLText }}</span>
+  {{- end }}
+</span>`)
+
+	mustRegisterUnfurlRenderer("vimorg", "", `^https?://www\.vim\.org/scripts/script\.php\?script_id=(\d+)`, `
+<span class='slacklog-attachment slacklog-attachment-vimorg'>
+  <span class='slacklog-attachment-vimorg-servicename'>vim.org script #{{ index .Match 1 }}</span>
+  <span class='slacklog-attachment-vimorg-title'><a href='{{ .URL }}'>{{ if .Title }}{{ .Title }}{{ else }}{{ .URL }}{{ end }}</a></span>
+  {{- if .Text }}
+  <span class='slacklog-attachment-vimorg-text'>{{ .HTMLText }}</span>
+  {{- end }}
+</span>`)
+}
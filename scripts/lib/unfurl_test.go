@@ -0,0 +1,135 @@
+package slacklog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindUnfurlRenderer(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a    MessageAttachment
+		want string
+	}{
+		{"no url", MessageAttachment{Title: "bot", Text: "hello"}, ""},
+		{"generic url", MessageAttachment{FromURL: "https://example.com/", Title: "Example"}, ""},
+		{"original url", MessageAttachment{OriginalURL: "https://gist.github.com/foo/1"}, "gist"},
+		{"github service", MessageAttachment{ServiceName: "GitHub", FromURL: "https://github.com/vim/vim"}, "github"},
+		{"github issue before service", MessageAttachment{ServiceName: "GitHub", FromURL: "https://github.com/vim/vim/issues/1"}, "github-issue"},
+		{"github pull", MessageAttachment{FromURL: "https://github.com/vim/vim/pull/12"}, "github-issue"},
+		{"github commit", MessageAttachment{ServiceName: "GitHub", FromURL: "https://github.com/vim/vim/commit/0123456789abcdef"}, "github-commit"},
+		{"github non-unfurl", MessageAttachment{ServiceName: "GitHub", Title: "push"}, "github"},
+		{"twitter", MessageAttachment{ServiceName: "twitter", FromURL: "https://twitter.com/vim_jp/status/123"}, "twitter"},
+		{"x.com", MessageAttachment{ServiceName: "twitter", FromURL: "https://x.com/vim_jp/status/123"}, "twitter"},
+		{"twitter profile", MessageAttachment{ServiceName: "twitter", FromURL: "https://twitter.com/vim_jp"}, ""},
+		{"twitter url other service", MessageAttachment{FromURL: "https://twitter.com/vim_jp/status/123"}, ""},
+		{"youtube", MessageAttachment{FromURL: "https://www.youtube.com/watch?v=abc"}, "youtube"},
+		{"youtu.be", MessageAttachment{FromURL: "https://youtu.be/abc"}, "youtube"},
+		{"stackoverflow", MessageAttachment{FromURL: "https://ja.stackoverflow.com/questions/42"}, "stackoverflow"},
+		{"vim.org", MessageAttachment{FromURL: "https://www.vim.org/scripts/script.php?script_id=1"}, "vimorg"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := findUnfurlRenderer(&tc.a)
+			got := ""
+			if r != nil {
+				got = r.Name
+			}
+			if got != tc.want {
+				t.Errorf("findUnfurlRenderer() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderUnfurl(t *testing.T) {
+	g := &HTMLGenerator{c: NewTextConverter(nil, nil)}
+	for _, tc := range []struct {
+		name    string
+		a       MessageAttachment
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "generic",
+			a:    MessageAttachment{FromURL: "https://example.com/", Title: "Example", Pretext: "pre"},
+		},
+		{
+			name: "github",
+			a:    MessageAttachment{ServiceName: "GitHub", TitleLink: "https://github.com/vim/vim", Title: "vim/vim", Text: "Vim"},
+			want: []string{"slacklog-attachment-github'", "<a href='https://github.com/vim/vim'>vim/vim</a>", "Vim"},
+		},
+		{
+			name: "github-issue",
+			a:    MessageAttachment{FromURL: "https://github.com/vim/vim/pull/12", Title: "Fix"},
+			want: []string{"slacklog-attachment-github-issue", "vim/vim", "Pull Request #12", ">Fix</a>"},
+		},
+		{
+			name: "github-commit",
+			a:    MessageAttachment{FromURL: "https://github.com/vim/vim/commit/0123456789abcdef"},
+			want: []string{"slacklog-attachment-github-commit", "<code>0123456</code>", ">https://github.com/vim/vim/commit/0123456789abcdef</a>"},
+		},
+		{
+			name: "gist",
+			a:    MessageAttachment{FromURL: "https://gist.github.com/foo/1", Text: "<b>"},
+			want: []string{"slacklog-attachment-gist", "<pre class='slacklog-attachment-gist-text'>&lt;b&gt;</pre>"},
+		},
+		{
+			name: "twitter",
+			a: MessageAttachment{
+				ServiceName: "twitter", FromURL: "https://twitter.com/vim_jp/status/123",
+				AuthorName: "vim-jp", Text: "hello",
+				VideoHTML:      `<iframe src="javascript:alert(1)" onload="alert(1)"></iframe>`,
+				VideoHTMLWidth: 640, VideoHTMLHeight: 360,
+			},
+			want:    []string{"slacklog-attachment-twitter'", "vim-jp", "<iframe src='https://twitter.com/i/videos/tweet/123' width='640' height='360'"},
+			notWant: []string{"javascript", "onload"},
+		},
+		{
+			name:    "twitter without video",
+			a:       MessageAttachment{ServiceName: "twitter", FromURL: "https://twitter.com/vim_jp/status/123"},
+			want:    []string{"slacklog-attachment-twitter'"},
+			notWant: []string{"iframe"},
+		},
+		{
+			name: "youtube",
+			a:    MessageAttachment{FromURL: "https://youtu.be/abc", Title: "Video", ThumbURL: "https://i.ytimg.com/t.jpg", ThumbWidth: 480, ThumbHeight: 360},
+			want: []string{"slacklog-attachment-youtube", ">Video</a>", "<img src='https://i.ytimg.com/t.jpg' width='480' height='360'"},
+		},
+		{
+			name: "stackoverflow",
+			a:    MessageAttachment{FromURL: "https://stackoverflow.com/questions/42"},
+			want: []string{"slacklog-attachment-stackoverflow", "Stack Overflow"},
+		},
+		{
+			name: "vimorg",
+			a:    MessageAttachment{FromURL: "https://www.vim.org/scripts/script.php?script_id=1", Title: "foo.vim"},
+			want: []string{"slacklog-attachment-vimorg", "vim.org script #1", ">foo.vim</a>"},
+		},
+		{
+			name:    "liquid",
+			a:       MessageAttachment{FromURL: "https://gist.github.com/foo/1", Title: "{{ site }}"},
+			want:    []string{"&#123;&#123; site }}"},
+			notWant: []string{"{{"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := g.renderUnfurl(tc.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want == nil && got != "" {
+				t.Errorf("renderUnfurl() = %q, want empty", got)
+			}
+			for _, s := range tc.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("renderUnfurl() does not contain %q:\n%s", s, got)
+				}
+			}
+			for _, s := range tc.notWant {
+				if strings.Contains(got, s) {
+					t.Errorf("renderUnfurl() contains %q:\n%s", s, got)
+				}
+			}
+		})
+	}
+}
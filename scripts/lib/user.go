@@ -1,12 +1,12 @@
 package slacklog
 
 // UserTable : ユーザデータを保持する
-// UsersもUserMapも保持するユーザデータは同じで、UserMapはユーザIDをキーとする
-// mapとなっている。
+// UsersもUserMapも保持するユーザデータは同じで、UserMapはユーザIDとボットIDを
+// キーとするmapとなっている。ユーザIDとボットIDが同じ場合はユーザIDを優先する。
 // ユースケースに応じてUsersとUserMapは使い分ける。
 type UserTable struct {
 	Users []User
-	// key: user ID
+	// key: user ID or bot ID
 	UserMap map[string]*User
 }
 
@@ -18,15 +18,95 @@ func NewUserTable(path string) (*UserTable, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newUserTable(users), nil
+}
+
+func newUserTable(users []User) *UserTable {
 	userMap := make(map[string]*User, len(users))
 	for i, u := range users {
-		pu := &users[i]
-		userMap[u.ID] = pu
-		if u.Profile.BotID != "" {
-			userMap[u.Profile.BotID] = pu
+		userMap[u.ID] = &users[i]
+	}
+	// a bot ID never hides a user with the same ID.
+	for i, u := range users {
+		if u.Profile.BotID == "" {
+			continue
+		}
+		if owner, ok := userMap[u.Profile.BotID]; !ok || owner.ID != u.Profile.BotID {
+			userMap[u.Profile.BotID] = &users[i]
+		}
+	}
+	return &UserTable{users, userMap}
+}
+
+// DisplayName : userIDに対応するユーザの表示名を返す。
+// 本名が設定されていればそれを、なければ表示名を返す。ユーザが見つからない場合は
+// 空文字列を返す。
+func (t *UserTable) DisplayName(userID string) string {
+	if user, ok := t.UserMap[userID]; ok {
+		if user.Profile.RealName != "" {
+			return user.Profile.RealName
+		}
+		if user.Profile.DisplayName != "" {
+			return user.Profile.DisplayName
+		}
+	}
+	return ""
+}
+
+// GetUserByID : ユーザIDまたはボットIDに対応するユーザを返す。
+func (t *UserTable) GetUserByID(id string) (*User, bool) {
+	u, ok := t.UserMap[id]
+	return u, ok
+}
+
+// BotIdentity : ボットのメッセージの投稿者として表示する名前とアイコン。
+type BotIdentity struct {
+	Name string
+	// 48x48のアイコンのURL。不明な場合は空文字列。
+	Icon string
+}
+
+// ResolveBotIdentity : ボットのメッセージの投稿者を解決する。
+// 名前とアイコンはそれぞれ、メッセージ毎に指定されたusername/icons、投稿時点の
+// bot_profile、bot_idに対応するボットユーザ(getUserで引く)、userに対応するユー
+// ザの順に、最初に見つかったものを用いる。
+// getUserには(*UserTable).GetUserByIDやLogStore.GetUserByIDを渡す。
+func ResolveBotIdentity(msg *Message, getUser func(id string) (*User, bool)) BotIdentity {
+	var id BotIdentity
+	id.Name = msg.Username
+	if msg.Icons != nil {
+		id.Icon = msg.Icons.Image48
+	}
+	if p := msg.BotProfile; p != nil {
+		if id.Name == "" {
+			id.Name = p.Name
+		}
+		if id.Icon == "" && p.Icons != nil {
+			id.Icon = p.Icons.Image48
+		}
+	}
+	for _, uid := range []string{msg.BotID, msg.User} {
+		if id.Name != "" && id.Icon != "" {
+			break
+		}
+		if uid == "" {
+			continue
+		}
+		u, ok := getUser(uid)
+		if !ok {
+			continue
+		}
+		if id.Name == "" {
+			id.Name = u.Profile.RealName
+			if id.Name == "" {
+				id.Name = u.Name
+			}
+		}
+		if id.Icon == "" {
+			id.Icon = u.Profile.Image48
 		}
 	}
-	return &UserTable{users, userMap}, nil
+	return id
 }
 
 // User : ユーザ
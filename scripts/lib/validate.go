@@ -0,0 +1,257 @@
+package slacklog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Diagnosticの重要度
+const (
+	// ページの生成に失敗する、または誤ったページになるデータ
+	SeverityError = "error"
+	// ページは生成できるが、表示の一部が欠けるデータ
+	SeverityWarning = "warning"
+)
+
+// Diagnostic : validateで見つかったログデータの問題。
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	// 問題の種類。invalid-json, schema, bad-filename, invalid-ts,
+	// ts-day-mismatch, duplicate-ts, duplicate-id, orphan-reply, unknown-user,
+	// missing-channel-dir のいずれか。
+	Code string `json:"code"`
+	// ログデータのディレクトリからのファイルのパス
+	File string `json:"file"`
+	// ファイル中のJSON配列の要素の位置。ファイル全体の問題では-1となる。
+	Index   int    `json:"index"`
+	Ts      string `json:"ts,omitempty"`
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	where := d.File
+	if d.Index >= 0 {
+		where += fmt.Sprintf("[%d]", d.Index)
+	}
+	if d.Ts != "" {
+		where += " ts=" + d.Ts
+	}
+	return fmt.Sprintf("%s: %s: [%s] %s", d.Severity, where, d.Code, d.Message)
+}
+
+// Validator : convert-exported-logsで変換したログデータのディレクトリを検証す
+// る。
+type Validator struct {
+	dir string
+	cfg *Config
+	loc *time.Location
+
+	// users.jsonに含まれるユーザIDとボットID
+	users map[string]struct{}
+	diags []Diagnostic
+}
+
+// NewValidator : dirのログデータを検証するValidatorを生成する。
+// 日付はcfg.Timezone(空ならDefaultTimezone)で判定する。
+func NewValidator(dir string, cfg *Config) (*Validator, error) {
+	tz := cfg.Timezone
+	if tz == "" {
+		tz = DefaultTimezone
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", tz, err)
+	}
+	return &Validator{dir: dir, cfg: cfg, loc: loc}, nil
+}
+
+// Run : users.json, channels.jsonと対象のチャンネルの全てのメッセージファイル
+// を検証し、見つかった問題をファイル順に返す。
+func (v *Validator) Run(ctx context.Context) ([]Diagnostic, error) {
+	v.diags = nil
+	v.users = map[string]struct{}{}
+
+	v.validateArray("users.json", []string{"id", "name"}, func(i int, raw json.RawMessage) {
+		var u User
+		if v.decode("users.json", i, raw, &u) {
+			v.users[u.ID] = struct{}{}
+			if u.Profile.BotID != "" {
+				v.users[u.Profile.BotID] = struct{}{}
+			}
+		}
+	})
+
+	var channels []Channel
+	ids := map[string]struct{}{}
+	v.validateArray("channels.json", []string{"id", "name"}, func(i int, raw json.RawMessage) {
+		var ch Channel
+		if !v.decode("channels.json", i, raw, &ch) {
+			return
+		}
+		if _, ok := ids[ch.ID]; ok {
+			v.report(SeverityError, "duplicate-id", "channels.json", i, "", "duplicate channel id "+ch.ID)
+			return
+		}
+		ids[ch.ID] = struct{}{}
+		channels = append(channels, ch)
+	})
+
+	for _, ch := range FilterChannel(channels, v.cfg.Channels) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := v.validateChannel(ch); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(v.diags, func(i, j int) bool {
+		if v.diags[i].File != v.diags[j].File {
+			return v.diags[i].File < v.diags[j].File
+		}
+		return v.diags[i].Index < v.diags[j].Index
+	})
+	return v.diags, nil
+}
+
+func (v *Validator) report(severity, code, file string, index int, ts, msg string) {
+	v.diags = append(v.diags, Diagnostic{
+		Severity: severity,
+		Code:     code,
+		File:     filepath.ToSlash(file),
+		Index:    index,
+		Ts:       ts,
+		Message:  msg,
+	})
+}
+
+// validateArray : nameのファイルがオブジェクトの配列であり、各要素がrequiredの
+// キーを持つことを検証する。検証できた要素毎にfnを呼ぶ。
+func (v *Validator) validateArray(name string, required []string, fn func(i int, raw json.RawMessage)) {
+	b, err := os.ReadFile(filepath.Join(v.dir, name))
+	if err != nil {
+		v.report(SeverityError, "invalid-json", name, -1, "", err.Error())
+		return
+	}
+	var elems []json.RawMessage
+	if err := json.Unmarshal(b, &elems); err != nil {
+		v.report(SeverityError, "invalid-json", name, -1, "", err.Error())
+		return
+	}
+	for i, raw := range elems {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			v.report(SeverityError, "schema", name, i, "", "element is not an object")
+			continue
+		}
+		ok := true
+		for _, key := range required {
+			var s string
+			if err := json.Unmarshal(obj[key], &s); err != nil || s == "" {
+				v.report(SeverityError, "schema", name, i, "", fmt.Sprintf("%q must be a non-empty string", key))
+				ok = false
+			}
+		}
+		if ok {
+			fn(i, raw)
+		}
+	}
+}
+
+// decode : rawをdstに読み込む。型が合わない場合は報告してfalseを返す。
+func (v *Validator) decode(name string, i int, raw json.RawMessage, dst interface{}) bool {
+	err := json.Unmarshal(raw, dst)
+	if err == nil {
+		return true
+	}
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) {
+		err = fmt.Errorf("%q must be %s, not %s", te.Field, te.Type, te.Value)
+	}
+	v.report(SeverityError, "schema", name, i, "", err.Error())
+	return false
+}
+
+// validateChannel : チャンネルのディレクトリの全てのメッセージファイルを検証す
+// る。
+// tsの重複と、先頭のメッセージのないスレッドへの返信はチャンネル全体で調べる。
+func (v *Validator) validateChannel(ch Channel) error {
+	names, err := readDirNames(filepath.Join(v.dir, ch.ID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			v.report(SeverityWarning, "missing-channel-dir", ch.ID, -1, "", fmt.Sprintf("no messages for #%s", ch.Name))
+			return nil
+		}
+		return err
+	}
+
+	type position struct {
+		file  string
+		index int
+	}
+	type reply struct {
+		position
+		ts, threadTs string
+	}
+	seen := map[string]position{}
+	roots := map[string]struct{}{}
+	var replies []reply
+	for _, name := range names {
+		file := filepath.Join(ch.ID, name)
+		m := reMsgFilename.FindStringSubmatch(name)
+		if m == nil {
+			v.report(SeverityWarning, "bad-filename", file, -1, "", "not a YYYY-MM-DD.json file, which is skipped")
+			continue
+		}
+		day, err := time.ParseInLocation("2006-01-02.json", name, v.loc)
+		if err != nil {
+			v.report(SeverityError, "bad-filename", file, -1, "", "invalid date: "+err.Error())
+			continue
+		}
+		v.validateArray(file, []string{"type", "ts"}, func(i int, raw json.RawMessage) {
+			var msg Message
+			if !v.decode(file, i, raw, &msg) {
+				return
+			}
+			t, err := ParseTs(msg.Ts)
+			if err != nil {
+				v.report(SeverityError, "invalid-ts", file, i, msg.Ts, err.Error())
+				return
+			}
+			if d := t.In(v.loc).Format("2006-01-02"); d != day.Format("2006-01-02") {
+				v.report(SeverityError, "ts-day-mismatch", file, i, msg.Ts, fmt.Sprintf("posted on %s in %s", d, v.loc))
+			}
+			if p, ok := seen[msg.Ts]; ok {
+				v.report(SeverityError, "duplicate-ts", file, i, msg.Ts, fmt.Sprintf("also in %s[%d]", filepath.ToSlash(p.file), p.index))
+			} else {
+				seen[msg.Ts] = position{file, i}
+			}
+			if msg.User != "" && !msg.IsBotMessage() && msg.BotID == "" {
+				if _, ok := v.users[msg.User]; !ok {
+					v.report(SeverityWarning, "unknown-user", file, i, msg.Ts, "user "+msg.User+" is not in users.json")
+				}
+			}
+			if msg.ThreadTs != "" {
+				if msg.IsRootOfThread() {
+					roots[msg.Ts] = struct{}{}
+				} else if _, err := ParseTs(msg.ThreadTs); err != nil {
+					v.report(SeverityError, "invalid-ts", file, i, msg.Ts, "thread_ts: "+err.Error())
+				} else {
+					replies = append(replies, reply{position{file, i}, msg.Ts, msg.ThreadTs})
+				}
+			}
+		})
+	}
+	for _, r := range replies {
+		if _, ok := roots[r.threadTs]; !ok {
+			v.report(SeverityWarning, "orphan-reply", r.file, r.index, r.ts, "no root message for thread_ts "+r.threadTs)
+		}
+	}
+	return nil
+}
@@ -1,21 +1,23 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
 	"os"
+	"os/signal"
 
 	"github.com/vim-jp/slacklog/lib/subcmd"
-
-	"github.com/joho/godotenv"
 )
 
 func main() {
-	err := godotenv.Load()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "[warning] failed to load .env file\n")
-	}
-	if err := subcmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "[error] %s\n", err)
-		os.Exit(1)
+	// stop cleanly on SIGINT: pages not yet started are skipped.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := subcmd.Run(ctx)
+	code := subcmd.ExitCode(err)
+	if code == 1 {
+		slog.Error(err.Error())
 	}
+	stop()
+	os.Exit(code)
 }
@@ -20,7 +20,7 @@ generate_html() {
   rm -rf $outdir
   echo "generate_html to: $outdir" 1>&2
   mkdir -p $outdir
-  go run ./main.go generate-html ./config.json ../slacklog_template/ ../slacklog_data/ ${outdir} > ${outdir}.generate-html.log 2>&1
+  go run ./main.go generate-html -config ./config.json -out-dir ${outdir} > ${outdir}.generate-html.log 2>&1
 }
 
 outrootdir=../tmp/pages_diff